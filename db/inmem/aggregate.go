@@ -0,0 +1,254 @@
+package inmem
+
+import (
+	"context"
+	"sort"
+	"strconv"
+)
+
+// Count returns how many rows in table match where. A nil where matches every row. Like every aggregate, it is
+// answered from the column indexes without reading row data
+func (db *DB) Count(ctx context.Context, table string, where Predicate) (int, error) {
+	var n int
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		n, err = tx.Count(ctx, table, where)
+		return err
+	})
+
+	return n, err
+}
+
+// Distinct returns the values col holds across the rows in table, sorted as strings
+func (db *DB) Distinct(ctx context.Context, table string, col string) ([]string, error) {
+	var vals []string
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		vals, err = tx.Distinct(ctx, table, col)
+		return err
+	})
+
+	return vals, err
+}
+
+// GroupByCount returns how many rows in table hold each value of col. Rows without a value for col aren't counted
+// EXAMPLE:
+//
+//	byStatus, err := db.GroupByCount(ctx, "imports", "status")
+//	if err != nil {
+//		return err
+//	}
+//	log.Printf("%d imports failed", byStatus["failed"])
+func (db *DB) GroupByCount(ctx context.Context, table string, col string) (map[string]int, error) {
+	var groups map[string]int
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		groups, err = tx.GroupByCount(ctx, table, col)
+		return err
+	})
+
+	return groups, err
+}
+
+// Sum returns the sum of col over the rows in table matching where, reading its values as numbers. Rows without a
+// value for col are left out, and a value that isn't a number fails with ErrNotNumeric
+func (db *DB) Sum(ctx context.Context, table string, col string, where Predicate) (float64, error) {
+	var sum float64
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		sum, err = tx.Sum(ctx, table, col, where)
+		return err
+	})
+
+	return sum, err
+}
+
+// Min returns the smallest value of col over the rows in table matching where, reading its values as numbers like Sum.
+// It fails with ErrValueNotFound if no row has a value for col
+func (db *DB) Min(ctx context.Context, table string, col string, where Predicate) (float64, error) {
+	var n float64
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		n, err = tx.Min(ctx, table, col, where)
+		return err
+	})
+
+	return n, err
+}
+
+// Max returns the largest value of col over the rows in table matching where, reading its values as numbers like Sum.
+// It fails with ErrValueNotFound if no row has a value for col
+func (db *DB) Max(ctx context.Context, table string, col string, where Predicate) (float64, error) {
+	var n float64
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		n, err = tx.Max(ctx, table, col, where)
+		return err
+	})
+
+	return n, err
+}
+
+// Count returns how many rows in table match where. See DB.Count
+func (tx *Tx) Count(ctx context.Context, table string, where Predicate) (int, error) {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	v, unlock, err := tx.rview(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	rowIDs, err := v.eval(ctx, where)
+	return len(rowIDs), err
+}
+
+// Distinct returns the values col holds across the rows in table. See DB.Distinct
+func (tx *Tx) Distinct(ctx context.Context, table string, col string) ([]string, error) {
+	groups, err := tx.GroupByCount(ctx, table, col)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := make([]string, 0, len(groups))
+	for v := range groups {
+		vals = append(vals, v)
+	}
+	sort.Strings(vals)
+
+	return vals, nil
+}
+
+// GroupByCount returns how many rows in table hold each value of col. See DB.GroupByCount
+func (tx *Tx) GroupByCount(ctx context.Context, table string, col string) (map[string]int, error) {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	v, unlock, err := tx.rview(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return v.groups(ctx, colName(col))
+}
+
+// Sum returns the sum of col over the rows in table matching where. See DB.Sum
+func (tx *Tx) Sum(ctx context.Context, table string, col string, where Predicate) (float64, error) {
+	sum := 0.0
+	err := tx.numbers(ctx, table, col, where, func(n float64) {
+		sum += n
+	})
+
+	return sum, err
+}
+
+// Min returns the smallest value of col over the rows in table matching where. See DB.Min
+func (tx *Tx) Min(ctx context.Context, table string, col string, where Predicate) (float64, error) {
+	return tx.extreme(ctx, table, col, where, func(n, best float64) bool { return n < best })
+}
+
+// Max returns the largest value of col over the rows in table matching where. See DB.Max
+func (tx *Tx) Max(ctx context.Context, table string, col string, where Predicate) (float64, error) {
+	return tx.extreme(ctx, table, col, where, func(n, best float64) bool { return n > best })
+}
+
+// extreme returns the value of col over the rows in table matching where that beats every other, by beats
+func (tx *Tx) extreme(ctx context.Context, table string, col string, where Predicate, beats func(n, best float64) bool) (float64, error) {
+	var best float64
+	found := false
+	err := tx.numbers(ctx, table, col, where, func(n float64) {
+		if !found || beats(n, best) {
+			best, found = n, true
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if !found {
+		return 0, &Error{Err: ErrValueNotFound, Table: table, Column: col}
+	}
+	return best, nil
+}
+
+// numbers calls fn with the value of col, as a number, of every row in table matching where that has one
+func (tx *Tx) numbers(ctx context.Context, table string, col string, where Predicate, fn func(n float64)) error {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	v, unlock, err := tx.rview(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c := colName(col)
+	if _, err := v.column(c); err != nil {
+		return err
+	}
+
+	rowIDs, err := v.eval(ctx, where)
+	if err != nil {
+		return err
+	}
+
+	for i, rid := range rowIDs {
+		if i%scanCheckInterval == 0 && i > 0 {
+			if err := v.pause(ctx); err != nil {
+				return err
+			}
+		}
+
+		ver, _ := v.lookup(rid)
+		cv, found := ver.vals[c]
+		if !found {
+			continue
+		}
+
+		n, err := strconv.ParseFloat(string(cv), 64)
+		if err != nil {
+			return &Error{Err: ErrNotNumeric, Table: table, Column: col, Value: string(cv)}
+		}
+		fn(n)
+	}
+
+	return nil
+}
+
+// groups returns how many rows hold each value of column c as the transaction sees them, walking the column's index.
+// Buckets can hold rows whose value has since changed, so each row is only counted under the value it holds now
+func (v *view) groups(ctx context.Context, c colName) (map[string]int, error) {
+	col, err := v.column(c)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]int, len(col))
+	visited := 0
+	for cv, bucket := range col {
+		for _, rid := range bucket {
+			if visited%scanCheckInterval == 0 {
+				// the walk can carry on across a pause: buckets are copied on write, and rows added to col meanwhile
+				// aren't visible to the snapshot
+				if err := v.pause(ctx); err != nil {
+					return nil, err
+				}
+			}
+			visited++
+
+			// rows the transaction wrote are counted below, as they may not be in the index yet
+			if _, writing := v.writes[rid]; writing {
+				continue
+			}
+			if ver, found := v.lookup(rid); found && holds(ver, c, cv) {
+				groups[string(cv)]++
+			}
+		}
+	}
+
+	for rid := range v.writes {
+		if ver, found := v.lookup(rid); found {
+			if cv, found := ver.vals[c]; found {
+				groups[string(cv)]++
+			}
+		}
+	}
+
+	return groups, nil
+}
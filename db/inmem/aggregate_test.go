@@ -0,0 +1,160 @@
+package inmem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+// aggregateDB returns a DB holding imports with a status and a size. import4 has no size, import2 has moved from cs1
+// to cs2 and import5 was deleted, so their old values are still in the indexes
+func aggregateDB(t *testing.T) *inmem.DB {
+	ctx := context.Background()
+	db := inmem.NewDB([]inmem.Table{{Name: "imports", Columns: []string{"csid", "status", "size"}, Unique: []string{"id"}}})
+
+	for _, err := range []error{
+		db.Insert(ctx, "imports", []string{"id", "csid", "status", "size"}, []string{"import1", "cs1", "done", "10"}, nil),
+		db.Insert(ctx, "imports", []string{"id", "csid", "status", "size"}, []string{"import2", "cs1", "failed", "2.5"}, nil),
+		db.Insert(ctx, "imports", []string{"id", "csid", "status", "size"}, []string{"import3", "cs2", "done", "-4"}, nil),
+		db.Insert(ctx, "imports", []string{"id", "csid", "status"}, []string{"import4", "cs3", "pending"}, nil),
+		db.Insert(ctx, "imports", []string{"id", "csid", "status", "size"}, []string{"import5", "cs4", "done", "100"}, nil),
+		db.UpdateRow(ctx, "imports", "id", "import2", []string{"csid"}, []string{"cs2"}, nil),
+		db.Delete(ctx, "imports", "id", "import5"),
+	} {
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+	}
+
+	return db
+}
+
+func TestDB_Aggregates(t *testing.T) {
+
+	ctx := context.Background()
+	db := aggregateDB(t)
+
+	t.Run("should count matching rows", func(t *testing.T) {
+		for _, tc := range []struct {
+			where inmem.Predicate
+			want  int
+		}{
+			{where: nil, want: 4},
+			{where: inmem.Eq("status", "done"), want: 2},
+			{where: inmem.Eq("csid", "cs1"), want: 1},
+			{where: inmem.Eq("csid", "cs4"), want: 0},
+		} {
+			got, err := db.Count(ctx, "imports", tc.where)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		}
+	})
+
+	t.Run("should list distinct values", func(t *testing.T) {
+		got, err := db.Distinct(ctx, "imports", "csid")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"cs1", "cs2", "cs3"}, got)
+	})
+
+	t.Run("should count rows by value", func(t *testing.T) {
+		got, err := db.GroupByCount(ctx, "imports", "status")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]int{"done": 2, "failed": 1, "pending": 1}, got)
+	})
+
+	t.Run("should sum, min and max numeric values", func(t *testing.T) {
+		sum, err := db.Sum(ctx, "imports", "size", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 8.5, sum)
+
+		min, err := db.Min(ctx, "imports", "size", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, -4.0, min)
+
+		max, err := db.Max(ctx, "imports", "size", inmem.Eq("csid", "cs2"))
+		assert.Nil(t, err)
+		assert.Equal(t, 2.5, max)
+	})
+
+	t.Run("should include a transaction's own writes", func(t *testing.T) {
+		tx, err := db.Begin(ctx)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer tx.Rollback()
+
+		for _, err := range []error{
+			tx.Insert(ctx, "imports", []string{"id", "csid", "status", "size"}, []string{"import6", "cs5", "failed", "1"}, nil),
+			tx.UpdateRow(ctx, "imports", "id", "import1", []string{"status"}, []string{"failed"}, nil),
+		} {
+			if !assert.Nil(t, err) {
+				return
+			}
+		}
+
+		groups, err := tx.GroupByCount(ctx, "imports", "status")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]int{"done": 1, "failed": 3, "pending": 1}, groups)
+
+		count, err := tx.Count(ctx, "imports", inmem.Eq("status", "failed"))
+		assert.Nil(t, err)
+		assert.Equal(t, 3, count)
+
+		sum, err := tx.Sum(ctx, "imports", "size", inmem.Eq("status", "failed"))
+		assert.Nil(t, err)
+		assert.Equal(t, 13.5, sum)
+	})
+}
+
+func TestDB_AggregateErrors(t *testing.T) {
+
+	ctx := context.Background()
+	db := aggregateDB(t)
+
+	testCases := []struct {
+		name      string
+		aggregate func() error
+		wantErr   error
+	}{
+		{
+			name: "should fail to sum values that aren't numbers",
+			aggregate: func() error {
+				_, err := db.Sum(ctx, "imports", "status", nil)
+				return err
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrNotNumeric, Table: "imports", Column: "status", Value: "done"},
+		},
+		{
+			name: "should fail to find the min of no values",
+			aggregate: func() error {
+				_, err := db.Min(ctx, "imports", "size", inmem.Eq("csid", "cs3"))
+				return err
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrValueNotFound, Table: "imports", Column: "size"},
+		},
+		{
+			name: "should fail to group by an unknown column",
+			aggregate: func() error {
+				_, err := db.GroupByCount(ctx, "imports", "owner")
+				return err
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotFound, Table: "imports", Column: "owner"},
+		},
+		{
+			name: "should fail to count an unknown table",
+			aggregate: func() error {
+				_, err := db.Count(ctx, "files", nil)
+				return err
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "files"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			assert.Equal(t, tc.wantErr, tc.aggregate())
+		})
+	}
+}
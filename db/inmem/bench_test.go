@@ -0,0 +1,77 @@
+package inmem_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+)
+
+// BenchmarkDB_Mixed runs a mix of inserts, reads and updates from parallel goroutines. With several tables each
+// goroutine sticks to one of them, so the workers only contend when they share a table. The global cases are the
+// baseline: every call takes one mutex first, as if the whole DB were locked
+func BenchmarkDB_Mixed(b *testing.B) {
+	for _, global := range []bool{false, true} {
+		for _, numTables := range []int{1, 4, 16} {
+			b.Run(fmt.Sprintf("global=%t/tables=%d", global, numTables), func(b *testing.B) {
+				tables := make([]inmem.Table, numTables)
+				for i := range tables {
+					tables[i] = inmem.Table{Name: "table" + strconv.Itoa(i), Columns: []string{"id", "status"}}
+				}
+				db := inmem.NewDB(tables)
+				ctx := context.Background()
+
+				var mu sync.Mutex
+				lock := func() func() {
+					if !global {
+						return func() {}
+					}
+					mu.Lock()
+					return mu.Unlock
+				}
+
+				// b.Fatal can't be called from the parallel goroutines, so the first error stops them and fails the
+				// benchmark once they are done
+				var (
+					worker  uint64
+					errOnce sync.Once
+					failed  error
+					stop    int32
+				)
+				b.RunParallel(func(pb *testing.PB) {
+					w := atomic.AddUint64(&worker, 1)
+					table := tables[int(w)%numTables].Name
+					prefix := strconv.FormatUint(w, 10) + "-"
+
+					for i := 0; pb.Next() && atomic.LoadInt32(&stop) == 0; i++ {
+						id := prefix + strconv.Itoa(i/4)
+						unlock := lock()
+						var err error
+						switch i % 4 {
+						case 0:
+							err = db.Insert(ctx, table, []string{"id", "status"}, []string{id, "pending"}, []byte(id))
+						case 1, 2:
+							_, err = db.Get(ctx, table, "id", id)
+						case 3:
+							err = db.UpdateRow(ctx, table, "id", id, []string{"status"}, []string{"done"}, []byte(id))
+						}
+						unlock()
+
+						if err != nil {
+							errOnce.Do(func() { failed = err })
+							atomic.StoreInt32(&stop, 1)
+							return
+						}
+					}
+				})
+				if failed != nil {
+					b.Fatal(failed)
+				}
+			})
+		}
+	}
+}
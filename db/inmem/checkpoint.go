@@ -0,0 +1,274 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkpointExt is the extension of checkpoint files. Checkpoints are snapshots named for the commit timestamp they
+// were taken at, zero padded so they sort in order, followed by the time they were taken, so Recover can target a
+// time without the log the checkpoint replaced
+const checkpointExt = ".snap"
+
+func checkpointName(ts uint64, at time.Time) string {
+	return fmt.Sprintf("%020d-%d%s", ts, at.UnixNano(), checkpointExt)
+}
+
+// WithCheckpointInterval makes a DB opened with Open checkpoint every d in the background
+func WithCheckpointInterval(d time.Duration) Option {
+	return func(db *DB) {
+		db.checkpointInterval = d
+	}
+}
+
+// WithCheckpointRetention makes a DB opened with Open keep its latest n checkpoints, and the log written since the
+// oldest of them, so Recover can restore it as it was at any point since. By default only the latest checkpoint is
+// kept
+func WithCheckpointRetention(n int) Option {
+	return func(db *DB) {
+		db.checkpointRetention = n
+	}
+}
+
+// WithCheckpointSize makes a DB opened with Open checkpoint in the background whenever the log segment being written
+// grows past n bytes
+func WithCheckpointSize(n int64) Option {
+	return func(db *DB) {
+		db.checkpointSize = n
+	}
+}
+
+// Checkpoint compacts the log of a DB opened with Open. The log moves on to a new segment, a snapshot of every table
+// is written alongside it, and the segments and checkpoints it replaces are deleted. Open then loads the latest
+// checkpoint and only replays the log written after it. Writers carry on while a checkpoint is taken. Checkpoint does
+// nothing on a DB created with NewDB
+func (db *DB) Checkpoint(ctx context.Context) error {
+	if db.wal == nil {
+		return nil
+	}
+
+	db.checkpointMu.Lock()
+	defer db.checkpointMu.Unlock()
+
+	seq, last, err := db.wal.rotate()
+	if err != nil {
+		return err
+	}
+
+	// commits logged to the old segments may not be applied yet. The snapshot must include all of them, since the
+	// segments are deleted once it is written
+	db.waitPublished(last)
+
+	dir := db.wal.dir
+	tmp, err := os.CreateTemp(dir, "checkpoint-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	ts, err := db.saveSnapshot(ctx, tmp)
+	// every commit in the snapshot was logged before it was taken
+	at := db.now()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, checkpointName(ts, at))); err != nil {
+		return err
+	}
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+
+	return db.compact(seq, ts)
+}
+
+// compact deletes the checkpoints before the ones kept, the latest of which was taken at ts, and the log segments
+// before segment seq that only hold commits the oldest kept checkpoint includes
+func (db *DB) compact(seq uint64, ts uint64) error {
+	dir := db.wal.dir
+
+	ckpts, err := checkpoints(dir)
+	if err != nil {
+		return err
+	}
+	keep := db.checkpointRetention
+	if keep < 1 {
+		keep = 1
+	}
+	if len(ckpts) > keep {
+		ckpts = ckpts[len(ckpts)-keep:]
+	}
+	oldest, err := checkpointTS(ckpts[0])
+	if err != nil {
+		return fmt.Errorf("%w: bad checkpoint name %q", ErrBadLog, ckpts[0])
+	}
+
+	names, err := segments(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if s, err := segmentSeq(name); err != nil || s >= seq {
+			break
+		}
+
+		path := filepath.Join(dir, name)
+		if oldest < ts {
+			// the segment may hold commits after the oldest checkpoint, which Recover needs
+			var last uint64
+			if _, _, err := scanSegment(path, false, func(rec *logRecord) error {
+				if rec.ts > last {
+					last = rec.ts
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if last > oldest {
+				break
+			}
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	all, err := checkpoints(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range all {
+		if c, err := checkpointTS(name); err == nil && c < oldest {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return syncDir(dir)
+}
+
+// checkpoints returns the names of the checkpoints in dir, oldest first
+func checkpoints(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), checkpointExt) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// checkpointTS returns the commit timestamp of the checkpoint called name
+func checkpointTS(name string) (uint64, error) {
+	ts := strings.SplitN(strings.TrimSuffix(name, checkpointExt), "-", 2)[0]
+	return strconv.ParseUint(ts, 10, 64)
+}
+
+// checkpointAt returns the time the checkpoint called name was taken. Checkpoints written before the time was recorded
+// in their names have none
+func checkpointAt(name string) (time.Time, bool) {
+	parts := strings.SplitN(strings.TrimSuffix(name, checkpointExt), "-", 2)
+	if len(parts) < 2 {
+		return time.Time{}, false
+	}
+
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// loadCheckpoint restores the DB from the latest checkpoint in dir taken at or before commit target, returning the
+// commit timestamp it was taken at. It returns 0 if there are no such checkpoints
+func (db *DB) loadCheckpoint(dir string, target uint64) (uint64, error) {
+	names, err := checkpoints(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var name string
+	for _, n := range names {
+		if ts, err := checkpointTS(n); err == nil && ts <= target {
+			name = n
+		}
+	}
+	if name == "" {
+		return 0, nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0, err
+	}
+
+	ts, tables, err := readSnapshot(b)
+	if err != nil {
+		return 0, fmt.Errorf("checkpoint %s: %w", name, err)
+	}
+
+	if err := db.restore(ts, tables); err != nil {
+		return 0, fmt.Errorf("checkpoint %s: %w", name, err)
+	}
+	return ts, nil
+}
+
+// startCheckpoints starts checkpointing in the background, if the DB was created with a checkpoint option
+func (db *DB) startCheckpoints() {
+	if db.checkpointInterval <= 0 && db.checkpointSize <= 0 {
+		return
+	}
+
+	db.wal.fullSize = db.checkpointSize
+
+	db.background.Add(1)
+	go db.checkpoints()
+}
+
+// checkpoints checkpoints the DB each time a trigger fires, until the DB is closed. The first error is kept for Close
+// to return; later checkpoints are still attempted, since the error may have been temporary
+func (db *DB) checkpoints() {
+	defer db.background.Done()
+
+	var tick <-chan time.Time
+	if db.checkpointInterval > 0 {
+		ticker := time.NewTicker(db.checkpointInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-db.closing:
+			return
+		case <-tick:
+		case <-db.wal.full:
+		}
+
+		if err := db.Checkpoint(context.Background()); err != nil && db.checkpointErr == nil {
+			db.checkpointErr = err
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package inmem_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Checkpoint(t *testing.T) {
+
+	testCases := []struct {
+		name string
+		// before runs before the checkpoint and after runs after it, before the DB is closed and opened again
+		before func(db *inmem.DB) error
+		after  func(db *inmem.DB) error
+		read   func(r reader) ([][]byte, error)
+		want   [][]byte
+	}{
+		{
+			name: "should restore rows from the checkpoint",
+			before: func(db *inmem.DB) error {
+				ctx := context.Background()
+				for _, err := range []error{
+					db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")),
+					db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, []byte("import2")),
+					db.Delete(ctx, "imports", "id", "import2"),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1")},
+		},
+		{
+			name: "should replay writes made after the checkpoint",
+			before: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1"))
+			},
+			after: func(db *inmem.DB) error {
+				ctx := context.Background()
+				if err := db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, []byte("import2")); err != nil {
+					return err
+				}
+				return db.UpdateRow(ctx, "imports", "id", "import1", []string{"csid"}, []string{"cs1"}, []byte("import1-updated"))
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1-updated"), []byte("import2")},
+		},
+		{
+			name: "should restore schema changes made either side of the checkpoint",
+			before: func(db *inmem.DB) error {
+				ctx := context.Background()
+				if err := db.CreateTable(ctx, inmem.Table{Name: "files", Columns: []string{"csid"}}); err != nil {
+					return err
+				}
+				return db.Insert(ctx, "files", []string{"csid", "name"}, []string{"cs1", "b/file1"}, []byte("file1"))
+			},
+			after: func(db *inmem.DB) error {
+				return db.CreateIndex(context.Background(), "files", inmem.Index{Column: "name", Ordered: true})
+			},
+			read: func(r reader) ([][]byte, error) {
+				return r.Query(context.Background(), "files", inmem.Prefix("name", "b/"))
+			},
+			want: [][]byte{[]byte("file1")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			dir := t.TempDir()
+			db, err := inmem.Open(dir, walTables)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			if !assert.Nil(t, tc.before(db)) || !assert.Nil(t, db.Checkpoint(context.Background())) {
+				return
+			}
+
+			// only the checkpoint and the segment after it are left
+			ckpts, _ := filepath.Glob(filepath.Join(dir, "*.snap"))
+			logs, _ := filepath.Glob(filepath.Join(dir, "*.wal"))
+			assert.Len(t, ckpts, 1)
+			assert.Len(t, logs, 1)
+
+			if tc.after != nil && !assert.Nil(t, tc.after(db)) {
+				return
+			}
+			if !assert.Nil(t, db.Close()) {
+				return
+			}
+
+			db, err = inmem.Open(dir, walTables)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer db.Close()
+
+			got, err := tc.read(db)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB_CheckpointSize(t *testing.T) {
+
+	dir := t.TempDir()
+	db, err := inmem.Open(dir, walTables, inmem.WithCheckpointSize(1))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	ctx := context.Background()
+	if !assert.Nil(t, db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1"))) {
+		return
+	}
+
+	// the checkpoint is taken in the background
+	assert.Eventually(t, func() bool {
+		ckpts, _ := filepath.Glob(filepath.Join(dir, "*.snap"))
+		return len(ckpts) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	if !assert.Nil(t, db.Close()) {
+		return
+	}
+
+	db, err = inmem.Open(dir, walTables)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer db.Close()
+
+	got, err := db.Get(ctx, "imports", "csid", "cs1")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("import1")}, got)
+}
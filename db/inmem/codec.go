@@ -0,0 +1,174 @@
+package inmem
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// encoder writes the fixed width, big endian fields the DB's files are made of. The first write error is kept and
+// every later write is skipped, so callers only check err once they are done
+type encoder struct {
+	w   io.Writer
+	buf [8]byte
+	err error
+}
+
+func (e *encoder) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(b)
+}
+
+func (e *encoder) uint8(v uint8) {
+	e.buf[0] = v
+	e.write(e.buf[:1])
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.uint8(1)
+		return
+	}
+	e.uint8(0)
+}
+
+func (e *encoder) uint32(v uint32) {
+	binary.BigEndian.PutUint32(e.buf[:4], v)
+	e.write(e.buf[:4])
+}
+
+func (e *encoder) uint64(v uint64) {
+	binary.BigEndian.PutUint64(e.buf[:8], v)
+	e.write(e.buf[:8])
+}
+
+// time writes t as nanoseconds since the Unix epoch, or 0 for the zero time
+func (e *encoder) time(t time.Time) {
+	if t.IsZero() {
+		e.uint64(0)
+		return
+	}
+	e.uint64(uint64(t.UnixNano()))
+}
+
+// nilBytes is the length written for a nil byte slice, so it reads back as nil rather than empty
+const nilBytes = ^uint32(0)
+
+// bytes writes b prefixed with its length, or nilBytes if b is nil
+func (e *encoder) bytes(b []byte) {
+	if b == nil {
+		e.uint32(nilBytes)
+		return
+	}
+	e.uint32(uint32(len(b)))
+	e.write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uint32(uint32(len(ss)))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+// errShortBuffer is kept by a decoder that runs out of input
+var errShortBuffer = errors.New("unexpected end of data")
+
+// decoder reads fields written by an encoder from b. Like encoder it keeps the first error, returning zero values
+// from then on
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.b) {
+		d.err = errShortBuffer
+		return nil
+	}
+
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) uint8() uint8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) bool() bool {
+	return d.uint8() == 1
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) time() time.Time {
+	ns := d.uint64()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ns))
+}
+
+// bytes reads a length prefixed byte slice, nil if it was written nil. The slice is copied, so it doesn't hold on to
+// the decoder's input
+func (d *decoder) bytes() []byte {
+	n := d.uint32()
+	if n == nilBytes {
+		return nil
+	}
+
+	b := d.next(int(n))
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+func (d *decoder) string() string {
+	b := d.next(int(d.uint32()))
+	return string(b)
+}
+
+func (d *decoder) strings() []string {
+	n := d.uint32()
+	if d.err != nil || int(n) > len(d.b) {
+		// every string takes at least its length prefix, so a count past the end of the input is corrupt
+		d.err = errShortBuffer
+		return nil
+	}
+
+	ss := make([]string, n)
+	for i := range ss {
+		ss[i] = d.string()
+	}
+	return ss
+}
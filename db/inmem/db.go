@@ -2,8 +2,11 @@ package inmem
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // An attempt to make a very generic inmem DB. To use, register desired tables and columns when NewDB is called
@@ -24,150 +27,612 @@ import (
 // }
 
 // DB ...
+//
+// Rows are multi-versioned: every commit stamps the versions it writes with the next commit timestamp, and reads see
+// the table as of a snapshot timestamp. A Tx keeps its snapshot for its whole life, so it reads a consistent view of
+// every table without holding any lock between statements, while writers carry on committing new versions. Versions
+// no snapshot can see any more are garbage collected after each commit and whenever the oldest snapshot is released
+//
+// Each table has its own lock, so writes to one table don't wait on writes to another. mu only protects the map of
+// tables. Commits lock every table they write in name order, so transactions spanning tables can't deadlock
+//
+// Every call gives up with ctx.Err() if its context is done while it waits for a lock or scans rows. WithCallTimeout
+// bounds every call, for callers whose contexts carry no deadline
 type DB struct {
 	mu     sync.RWMutex
 	tables map[string]*table
+	strict bool
+	// tablesMu serializes creating and dropping tables. It is held while the change is logged and its timestamp
+	// published, which mu can't be: publishing waits for earlier changes, and dropping a table needs mu
+	tablesMu sync.Mutex
+	// callTimeout bounds every call, if set
+	callTimeout time.Duration
+	// wal is the log commits are written to before they are applied, for DBs opened with Open
+	wal *wal
+	// checkpointMu serializes checkpoints, which are taken in the background when either trigger is set
+	checkpointMu       sync.Mutex
+	checkpointInterval time.Duration
+	checkpointSize     int64
+	// checkpointRetention is the number of checkpoints kept, along with the log since the oldest of them
+	checkpointRetention int
+	checkpointErr       error
+
+	// now is the DB's clock, which decides when rows expire
+	now func() time.Time
+	// sweepInterval is how often expired rows are swept in the background. The sweeper is started by the first
+	// commit of a row that expires
+	sweepInterval time.Duration
+	sweepOnce     sync.Once
+	// onEvict is called with the rows tables evict, if set
+	onEvict func(Evicted)
+	// hooks holds the hooks run on writes, by table
+	hooks map[string][]Hooks
+	// watchers holds the callers of Watch by table
+	watchMu  sync.RWMutex
+	watchers map[string]map[*watcher]bool
+	// closing is closed by Close to stop the DB's background work: checkpoints and sweeping. background counts the
+	// goroutines doing it
+	closing    chan struct{}
+	closeOnce  sync.Once
+	background sync.WaitGroup
+
+	// commitMu guards handing out commit timestamps and publishing them in order; committed is signalled on it
+	// whenever the clock moves
+	commitMu  sync.Mutex
+	committed *sync.Cond
+	// issued is the last commit timestamp handed out. Versions stamped with it may still be being installed
+	issued uint64
+	// clock is the timestamp of the last commit whose versions, and those of every commit before it, are all in
+	// place. It is only advanced while holding commitMu, but is read atomically so snapshots can be taken without
+	// any lock
+	clock uint64
+	// snapshots counts the open snapshots by timestamp, so garbage collection knows which versions are still needed
+	snapMu    sync.Mutex
+	snapshots map[uint64]int
 }
 
-// NewDB ...
-func NewDB(tables []Table) *DB {
+// Option configures a DB when it is created with NewDB
+type Option func(*DB)
+
+// WithStrictSchema makes every table strict, as if Table.Strict was set on each of them
+func WithStrictSchema() Option {
+	return func(db *DB) {
+		db.strict = true
+	}
+}
+
+// WithCallTimeout bounds every call on the DB or on a Tx by d, as if each was made with a context from
+// context.WithTimeout. Calls still fail sooner if their own context is done first
+func WithCallTimeout(d time.Duration) Option {
+	return func(db *DB) {
+		db.callTimeout = d
+	}
+}
+
+// NewDB returns a DB holding tables, empty. It panics with an error wrapping ErrUnknownEviction if a table's Eviction
+// policy isn't registered, just as CreateTable would fail
+func NewDB(tables []Table, opts ...Option) *DB {
+	db := &DB{
+		snapshots:     make(map[uint64]int),
+		now:           time.Now,
+		sweepInterval: defaultSweepInterval,
+		closing:       make(chan struct{}),
+	}
+	db.committed = sync.NewCond(&db.commitMu)
+	for _, opt := range opts {
+		opt(db)
+	}
+
 	t := make(map[string]*table)
 	for _, tbl := range tables {
-		t[tbl.Name] = newTable(tbl.Columns...)
+		if db.strict {
+			tbl.Strict = true
+		}
+		if err := checkEviction(tbl); err != nil {
+			panic(err)
+		}
+		t[tbl.Name] = newTable(tbl)
 	}
+	db.tables = t
 
-	return &DB{
-		tables: t,
-	}
+	return db
 }
 
 // Table is the exported representation of a table
 type Table struct {
 	Name    string
 	Columns []string
+	// Ordered columns are indexed in sorted order as well, so they can be queried with range and prefix predicates
+	// such as Gt, Between and Prefix. Ordered columns don't need to also be listed in Columns
+	Ordered []string
+	// Unique columns can't hold the same value in two rows. Insert and UpdateRow return an error wrapping
+	// ErrUniqueViolation instead of writing a duplicate. Unique columns don't need to also be listed in Columns
+	Unique []string
+	// PrimaryKey is an optional unique column identifying each row. Tables with a primary key support GetByKey and
+	// Upsert
+	PrimaryKey string
+	// Strict tables only accept the columns declared in Columns, Ordered, Unique and PrimaryKey. Writes and queries
+	// naming any other column fail instead of silently creating a new column
+	Strict bool
+	// TTL makes rows expire TTL after they are inserted or upserted, unless they are written with an expiry of their
+	// own. Expired rows are no longer visible to any read, and are swept from the table in the background
+	TTL time.Duration
+	// MaxRows and MaxBytes limit how many rows the table holds and roughly how much memory they take, counting their
+	// data and indexed values. Commits that would take the table over either limit evict rows picked by Eviction to
+	// make room, deleting them in the same commit. Zero means no limit
+	MaxRows  int
+	MaxBytes int64
+	// Eviction names the policy picking the rows to evict: LRU, LFU or one added with RegisterEvictionPolicy. It
+	// defaults to LRU
+	Eviction string
 }
 
 // Get ...
 func (db *DB) Get(ctx context.Context, table string, whereCol string, id string) ([][]byte, error) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
+	var rows [][]byte
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		rows, err = tx.Get(ctx, table, whereCol, id)
+		return err
+	})
 
-	tbl, found := db.tables[table]
-	if !found {
-		return nil, fmt.Errorf("table %q not found", table)
-	}
+	return rows, err
+}
 
-	return tbl.get(val(id), colName(whereCol))
+// GetByKey returns the data of the row in table whose primary key is key
+func (db *DB) GetByKey(ctx context.Context, table string, key string) ([]byte, error) {
+	var data []byte
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		data, err = tx.GetByKey(ctx, table, key)
+		return err
+	})
+
+	return data, err
 }
 
-func (t *table) get(id val, whereCol colName) ([][]byte, error) {
-	columnVals, found := t.rows[whereCol]
-	if !found {
-		return nil, fmt.Errorf("column %q not found", whereCol)
+// Insert ...
+func (db *DB) Insert(ctx context.Context, table string, cols []string, vals []string, data []byte) error {
+	return db.autocommit(ctx, table, func(ctx context.Context, tx *Tx) error {
+		return tx.Insert(ctx, table, cols, vals, data)
+	})
+}
+
+// InsertWithExpiry inserts a row into table that expires at expires. A zero expires falls back to the table's TTL
+func (db *DB) InsertWithExpiry(ctx context.Context, table string, cols []string, vals []string, data []byte, expires time.Time) error {
+	return db.autocommit(ctx, table, func(ctx context.Context, tx *Tx) error {
+		return tx.InsertWithExpiry(ctx, table, cols, vals, data, expires)
+	})
+}
+
+// Upsert inserts a row into table, or replaces the row with the same primary key if there is one. cols must include
+// the table's primary key. A replaced row keeps its place in insertion order, but its indexed values become exactly
+// cols and vals
+func (db *DB) Upsert(ctx context.Context, table string, cols []string, vals []string, data []byte) error {
+	return db.autocommit(ctx, table, func(ctx context.Context, tx *Tx) error {
+		return tx.Upsert(ctx, table, cols, vals, data)
+	})
+}
+
+// Update ...
+func (db *DB) Update(ctx context.Context, table string, col string, val string, data []byte) error {
+	return db.autocommit(ctx, table, func(ctx context.Context, tx *Tx) error {
+		return tx.Update(ctx, table, col, val, data)
+	})
+}
+
+// UpdateWithExpiry replaces the data of every row in table where col equals val, like Update, and makes the rows
+// expire at expires instead of when they were going to. A zero expires makes them never expire
+func (db *DB) UpdateWithExpiry(ctx context.Context, table string, col string, val string, data []byte, expires time.Time) error {
+	return db.autocommit(ctx, table, func(ctx context.Context, tx *Tx) error {
+		return tx.UpdateWithExpiry(ctx, table, col, val, data, expires)
+	})
+}
+
+// UpdateRow replaces the data of every row in table where whereCol equals id and sets the given cols to vals. Rows are
+// moved out of the index buckets for their old values and into the buckets for the new ones in the same write, so Gets
+// by the new value find the row and Gets by the old value no longer do. Indexed columns not listed in cols keep their
+// current values
+func (db *DB) UpdateRow(ctx context.Context, table string, whereCol string, id string, cols []string, vals []string, data []byte) error {
+	return db.autocommit(ctx, table, func(ctx context.Context, tx *Tx) error {
+		return tx.UpdateRow(ctx, table, whereCol, id, cols, vals, data)
+	})
+}
+
+// Delete removes every row in table where whereCol equals id. The rows are removed from every column index, so later
+// Gets on any column no longer return them
+func (db *DB) Delete(ctx context.Context, table string, whereCol string, id string) error {
+	return db.autocommit(ctx, table, func(ctx context.Context, tx *Tx) error {
+		return tx.Delete(ctx, table, whereCol, id)
+	})
+}
+
+// read runs fn in a read only transaction reading at the latest commit. fn is passed ctx bounded by the call timeout
+// and must run a single statement. The snapshot is taken once the table is locked and only registered if a long read
+// lets go of the lock now and then to let writers in
+func (db *DB) read(ctx context.Context, fn func(ctx context.Context, tx *Tx) error) error {
+	ctx, cancel := db.callContext(ctx)
+	defer cancel()
+
+	tx := db.newTx(ctx)
+	tx.reading = true
+	defer func() {
+		// versions only the snapshot could see are left for the next commit to the table to collect, rather than lock
+		// every table after each read
+		if tx.registered {
+			db.release(tx.snap)
+		}
+	}()
+
+	return fn(ctx, tx)
+}
+
+// autocommit runs fn in a transaction and commits it, all while holding table's write lock, so single writes made
+// directly on the DB behave exactly like a one statement transaction and never conflict. DBs with hooks use hooked
+// instead
+func (db *DB) autocommit(ctx context.Context, table string, fn func(ctx context.Context, tx *Tx) error) error {
+	ctx, cancel := db.callContext(ctx)
+	defer cancel()
+
+	if len(db.hooks) > 0 {
+		return db.hooked(ctx, fn)
 	}
 
-	rowNums := columnVals[id]
+	tx := db.newTx(ctx)
+	if err := func() error {
+		if t := db.lookup(table); t != nil {
+			if err := t.mu.lock(ctx); err != nil {
+				return err
+			}
+			defer t.mu.unlock()
+			tx.held[t] = true
+		}
+
+		tx.snap = atomic.LoadUint64(&db.clock)
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
 
-	toReturn := make([][]byte, len(rowNums))
-	for i, d := range rowNums {
-		toReturn[i] = t.rowData[d]
+		return tx.commit()
+	}(); err != nil {
+		return err
 	}
 
-	return toReturn, nil
+	// changes and rows are handed on once the lock is released, so watchers and the callback can use the table
+	tx.deliver()
+	db.onEvicted(tx.evicted)
+	return nil
 }
 
-// Insert ...
-func (db *DB) Insert(ctx context.Context, table string, cols []string, vals []string, data []byte) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// hooked is autocommit for DBs with hooks. Hooks can use any table, so holding table's lock while they run could
+// deadlock with a write to another table whose hooks use table. fn runs in a transaction like Begin's instead, which
+// lets go of the lock while hooks run, and commits that conflict are retried so DB writes still never conflict
+func (db *DB) hooked(ctx context.Context, fn func(ctx context.Context, tx *Tx) error) error {
+	for {
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(ctx, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
 
-	if len(cols) != len(vals) {
-		return fmt.Errorf("length of cols must mach vals")
+		// only conflicts found by Commit are retried; hooks may return ErrConflict to veto a write
+		if err := tx.Commit(); !errors.Is(err, ErrConflict) {
+			return err
+		}
 	}
+}
 
-	tbl, found := db.tables[table]
-	if !found {
-		return fmt.Errorf("table %q not found", tbl)
+// callContext returns ctx bounded by the DB's call timeout, if it has one, and the func to release it
+func (db *DB) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.callTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, db.callTimeout)
+}
+
+// lookup returns the table called name, or nil if there isn't one
+func (db *DB) lookup(name string) *table {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.tables[name]
+}
+
+// checkUnique returns an error if writing rows would leave two rows with the same value in a unique column. lookup
+// returns the rows currently holding a value; rows being written are ignored there since their new values are checked
+// against each other instead
+func (t *table) checkUnique(rows map[rowID]*version, lookup func(c colName, v val) ([]rowID, error)) error {
+	if len(t.unique) == 0 {
+		return nil
+	}
+
+	uniqueCols := make([]colName, 0, len(t.unique))
+	for c := range t.unique {
+		uniqueCols = append(uniqueCols, c)
+	}
+	sort.Slice(uniqueCols, func(i, j int) bool { return uniqueCols[i] < uniqueCols[j] })
+
+	rowIDs := sortedRowIDs(rows)
+	for _, c := range uniqueCols {
+		seen := make(map[val]bool)
+		for _, rid := range rowIDs {
+			ver := rows[rid]
+			if ver == nil {
+				continue
+			}
+
+			v, found := ver.vals[c]
+			if !found {
+				continue
+			}
+
+			if seen[v] {
+				return uniqueViolation(t.name, c, v)
+			}
+			seen[v] = true
+
+			holders, err := lookup(c, v)
+			if err != nil {
+				return err
+			}
+
+			for _, other := range holders {
+				if _, writing := rows[other]; !writing {
+					return uniqueViolation(t.name, c, v)
+				}
+			}
+		}
 	}
 
-	tbl.insert(row{
-		cols: cols,
-		vals: vals,
-		data: data,
-	})
 	return nil
 }
 
-func (t *table) insert(r row) {
-	t.rowData = append(t.rowData, r.data)
-	rowNum := len(t.rowData) - 1
+func uniqueViolation(table string, c colName, v val) error {
+	return &Error{Err: ErrUniqueViolation, Table: table, Column: string(c), Value: string(v)}
+}
 
-	for i, col := range r.cols {
-		c, found := t.rows[colName(col)]
-		if !found {
-			c = make(map[val][]int)
-			t.rows[colName(col)] = c
+// addColumns creates any of cols the table hasn't seen before
+func (t *table) addColumns(cols []string) {
+	for _, c := range cols {
+		if _, found := t.rows[colName(c)]; !found {
+			t.rows[colName(c)] = make(map[val][]rowID)
 		}
+	}
+}
 
-		c[val(r.vals[i])] = append(c[val(r.vals[i])], rowNum)
+// column returns the index for column c
+func (t *table) column(c colName) (map[val][]rowID, error) {
+	col, found := t.rows[c]
+	if !found {
+		if t.strict {
+			return nil, undeclaredColumn(t.name, c)
+		}
+		return nil, &Error{Err: ErrColumnNotFound, Table: t.name, Column: string(c)}
 	}
 
+	return col, nil
 }
 
-// Update ...
-func (db *DB) Update(ctx context.Context, table string, col string, val string, data []byte) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// checkColumns returns an error if a strict table is written with a column that wasn't declared
+func (t *table) checkColumns(cols []string) error {
+	if !t.strict {
+		return nil
+	}
 
-	if col == "" || val == "" {
-		return fmt.Errorf("column and value must be provided")
+	for _, c := range cols {
+		if _, found := t.rows[colName(c)]; !found {
+			return undeclaredColumn(t.name, colName(c))
+		}
 	}
 
-	tbl, found := db.tables[table]
+	return nil
+}
+
+func undeclaredColumn(table string, c colName) error {
+	return &Error{Err: ErrColumnNotDeclared, Table: table, Column: string(c)}
+}
+
+// index adds rid to the bucket for v in column c, creating the column if it hasn't been seen before. The bucket is kept
+// sorted by rowID so results come back in insertion order
+func (t *table) index(c colName, v val, rid rowID) {
+	col, found := t.rows[c]
 	if !found {
-		return fmt.Errorf("table %q not found", tbl)
+		col = make(map[val][]rowID)
+		t.rows[c] = col
+	}
+
+	bucket := col[v]
+	i := sort.Search(len(bucket), func(i int) bool { return bucket[i] >= rid })
+	if i < len(bucket) && bucket[i] == rid {
+		return
 	}
-	return tbl.update(col, val, data)
+
+	if len(bucket) == 0 {
+		if sl, found := t.ordered[c]; found {
+			sl.insert(v)
+		}
+	}
+
+	if i < len(bucket) && t.shared() {
+		grown := make([]rowID, len(bucket)+1)
+		copy(grown, bucket[:i])
+		grown[i] = rid
+		copy(grown[i+1:], bucket[i:])
+		col[v] = grown
+		return
+	}
+
+	bucket = append(bucket, 0)
+	copy(bucket[i+1:], bucket[i:])
+	bucket[i] = rid
+	col[v] = bucket
 }
 
-func (t *table) update(c, v string, d []byte) error {
+// unindex removes rid from the bucket for v in column c, dropping the bucket once it is empty
+func (t *table) unindex(c colName, v val, rid rowID) {
+	bucket := t.rows[c][v]
+	// buckets are appended to in rowID order, so they are always sorted
+	i := sort.Search(len(bucket), func(i int) bool { return bucket[i] >= rid })
+	if i == len(bucket) || bucket[i] != rid {
+		return
+	}
 
-	col, found := t.rows[colName(c)]
-	if !found {
-		return fmt.Errorf("column %q not found", c)
+	if len(bucket) == 1 {
+		delete(t.rows[c], v)
+		if sl, found := t.ordered[c]; found {
+			sl.remove(v)
+		}
+		return
 	}
 
-	rowNums, found := col[val(v)]
-	if !found {
-		return fmt.Errorf("val %q not found", v)
+	if !t.shared() {
+		t.rows[c][v] = append(bucket[:i], bucket[i+1:]...)
+		return
 	}
 
-	for _, rowNum := range rowNums {
-		t.rowData[rowNum] = d
+	// nothing within the old bucket's length can be overwritten. Its first row can be dropped by reslicing, as appends
+	// only write past its end; any other row is dropped from a copy
+	if i == 0 {
+		t.rows[c][v] = bucket[1:]
+		return
 	}
-	return nil
+	shrunk := make([]rowID, 0, len(bucket)-1)
+	shrunk = append(shrunk, bucket[:i]...)
+	t.rows[c][v] = append(shrunk, bucket[i+1:]...)
+}
+
+// shared reports whether a read that let go of the table's lock may still hold slices of its buckets. Buckets are
+// copied on write while one might, and changed in place otherwise. The caller must hold the write lock
+func (t *table) shared() bool {
+	return atomic.LoadInt32(&t.detached) > 0
 }
 
+// table holds the rows for one table. Every row gets a rowID when it is inserted that never changes or gets reused,
+// so the column indexes can refer to rows by ID and stay valid when other rows are deleted. A row is listed in the
+// bucket for every value held by any of its versions, so the indexes can return rows that no longer match at a given
+// snapshot; reads always check the visible version before returning a row
 type table struct {
-	rows    map[colName]map[val][]int
-	rowData [][]byte
+	mu      rwLock
+	name    string
+	strict  bool
+	rows    map[colName]map[val][]rowID
+	ordered map[colName]*skiplist
+	unique  map[colName]bool
+	pk      colName
+	rowData map[rowID]*record
+	nextID  rowID
+	// garbage queues the rows given a new version over an older one, in commit order, so collect only visits rows with
+	// versions that became collectable since it last ran
+	garbage []superseded
+	// dropped is set once the table is dropped, for callers that looked it up before
+	dropped bool
+	// ttl is how long rows written without an expiry live, if set
+	ttl time.Duration
+	// expiring holds the rows whose newest version expires, for the sweeper
+	expiring map[rowID]bool
+	// liveRows and liveBytes are the number and size of the rows as of the latest commit
+	liveRows  int
+	liveBytes int64
+	// evict picks the rows to evict, for tables with limits
+	evict    *evictor
+	maxRows  int
+	maxBytes int64
+	eviction string
+	// sent is closed once the latest commit to the table with changes to send has sent them to its watchers. Changes
+	// are sent after the table is unlocked, so each commit waits on the one before to keep them in commit order
+	sent chan struct{}
+	// detached counts the reads that let go of the lock partway through, and may still hold slices of the buckets
+	detached int32
 }
 
-func newTable(columns ...string) *table {
-	r := make(map[colName]map[val][]int)
-	for _, c := range columns {
-		r[colName(c)] = make(map[val][]int)
+func newTable(tbl Table) *table {
+	r := make(map[colName]map[val][]rowID)
+	for _, c := range tbl.Columns {
+		r[colName(c)] = make(map[val][]rowID)
+	}
+
+	o := make(map[colName]*skiplist)
+	for _, c := range tbl.Ordered {
+		r[colName(c)] = make(map[val][]rowID)
+		o[colName(c)] = newSkiplist()
+	}
+
+	u := make(map[colName]bool)
+	for _, c := range tbl.Unique {
+		if _, found := r[colName(c)]; !found {
+			r[colName(c)] = make(map[val][]rowID)
+		}
+		u[colName(c)] = true
+	}
+
+	if tbl.PrimaryKey != "" {
+		if _, found := r[colName(tbl.PrimaryKey)]; !found {
+			r[colName(tbl.PrimaryKey)] = make(map[val][]rowID)
+		}
+		u[colName(tbl.PrimaryKey)] = true
 	}
+
 	return &table{
-		rows: r,
+		name:     tbl.Name,
+		strict:   tbl.Strict,
+		rows:     r,
+		ordered:  o,
+		unique:   u,
+		pk:       colName(tbl.PrimaryKey),
+		rowData:  make(map[rowID]*record),
+		ttl:      tbl.TTL,
+		expiring: make(map[rowID]bool),
+		evict:    newEvictor(tbl),
+		maxRows:  tbl.MaxRows,
+		maxBytes: tbl.MaxBytes,
+		eviction: tbl.Eviction,
 	}
 }
 
 type row struct {
-	cols []string
-	vals []string
-	data []byte
+	cols    []string
+	vals    []string
+	data    []byte
+	expires time.Time
+}
+
+// version builds the row version r writes
+func (r row) version() *version {
+	ver := &version{
+		vals:    make(map[colName]val, len(r.cols)),
+		data:    r.data,
+		expires: r.expires,
+	}
+	for i, col := range r.cols {
+		ver.vals[colName(col)] = val(r.vals[i])
+	}
+
+	return ver
+}
+
+// val returns the value r sets for column c
+func (r row) val(c colName) (val, bool) {
+	for i, col := range r.cols {
+		if colName(col) == c {
+			return val(r.vals[i]), true
+		}
+	}
+	return "", false
 }
 
 type val string
 type colName string
+type rowID uint64
+
+// sortedRowIDs returns the keys of rows sorted ascending
+func sortedRowIDs(rows map[rowID]*version) []rowID {
+	rowIDs := make([]rowID, 0, len(rows))
+	for rid := range rows {
+		rowIDs = append(rowIDs, rid)
+	}
+	sort.Slice(rowIDs, func(i, j int) bool { return rowIDs[i] < rowIDs[j] })
+
+	return rowIDs
+}
@@ -2,8 +2,10 @@ package inmem_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"testing"
 
@@ -224,7 +226,7 @@ func TestDB1_Get(t *testing.T) {
 				col:        "importID",
 				aggID:      uuid.New().String(),
 			},
-			wantErr: fmt.Errorf("table %q not found", "winky wonky"),
+			wantErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "winky wonky"},
 		},
 		{
 			name: "should fail due to column not existing",
@@ -240,7 +242,7 @@ func TestDB1_Get(t *testing.T) {
 				col:        "winky wonky",
 				aggID:      uuid.New().String(),
 			},
-			wantErr: fmt.Errorf("column %q not found", "winky wonky"),
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotFound, Table: "imports", Column: "winky wonky"},
 		},
 	}
 	for _, tc := range testCases {
@@ -272,3 +274,862 @@ func TestDB1_Get(t *testing.T) {
 		})
 	}
 }
+
+func TestDB1_Delete(t *testing.T) {
+
+	csID := uuid.New().String()
+	aggid := uuid.New().String()
+	aggid2 := uuid.New().String()
+
+	type get struct {
+		col  string
+		id   string
+		want [][]byte
+	}
+
+	testCases := []struct {
+		name     string
+		table    string
+		col      string
+		id       string
+		setup    func(db *inmem.DB)
+		wantErr  error
+		wantGets []get
+	}{
+		{
+			name:  "should delete row from every column index",
+			table: "imports",
+			col:   "importID",
+			id:    aggid,
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"csid", "importID"}, []string{csID, aggid}, []byte("file1"))
+				db.Insert(context.Background(), "imports", []string{"csid", "importID"}, []string{csID, aggid2}, []byte("file2"))
+			},
+			wantGets: []get{
+				{col: "importID", id: aggid, want: [][]byte{}},
+				{col: "importID", id: aggid2, want: [][]byte{[]byte("file2")}},
+				{col: "csid", id: csID, want: [][]byte{[]byte("file2")}},
+			},
+		},
+		{
+			name:  "should delete every matching row",
+			table: "imports",
+			col:   "csid",
+			id:    csID,
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"csid", "importID"}, []string{csID, aggid}, []byte("file1"))
+				db.Insert(context.Background(), "imports", []string{"csid", "importID"}, []string{csID, aggid2}, []byte("file2"))
+				db.Insert(context.Background(), "imports", []string{"csid", "importID"}, []string{"other", "3"}, []byte("file3"))
+			},
+			wantGets: []get{
+				{col: "csid", id: csID, want: [][]byte{}},
+				{col: "importID", id: aggid2, want: [][]byte{}},
+				{col: "csid", id: "other", want: [][]byte{[]byte("file3")}},
+			},
+		},
+		{
+			name:    "should fail due to table not existing",
+			table:   "winky wonky",
+			col:     "importID",
+			id:      aggid,
+			wantErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "winky wonky"},
+		},
+		{
+			name:    "should fail due to column not existing",
+			table:   "imports",
+			col:     "winky wonky",
+			id:      aggid,
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotFound, Table: "imports", Column: "winky wonky"},
+		},
+		{
+			name:  "should fail due to value not existing",
+			table: "imports",
+			col:   "importID",
+			id:    aggid2,
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"importID"}, []string{aggid}, []byte("file1"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrValueNotFound, Table: "imports", Column: "importID", Value: aggid2},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{
+				{
+					Name: "imports",
+				},
+			})
+
+			if tc.setup != nil {
+				tc.setup(db)
+			}
+
+			gotErr := db.Delete(context.Background(), tc.table, tc.col, tc.id)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, gotErr)
+				return
+			}
+
+			if !assert.Nil(t, gotErr) {
+				return
+			}
+
+			for _, g := range tc.wantGets {
+				got, err := db.Get(context.Background(), tc.table, g.col, g.id)
+				if !assert.Nil(t, err) {
+					return
+				}
+				assert.Equal(t, g.want, got)
+			}
+		})
+	}
+}
+
+func TestDB1_UpdateRow(t *testing.T) {
+
+	csID := uuid.New().String()
+	aggid := uuid.New().String()
+	aggid2 := uuid.New().String()
+
+	type get struct {
+		col  string
+		id   string
+		want [][]byte
+	}
+
+	type args struct {
+		table    string
+		whereCol string
+		id       string
+		cols     []string
+		vals     []string
+		data     []byte
+	}
+
+	testCases := []struct {
+		name     string
+		args     args
+		setup    func(db *inmem.DB)
+		wantErr  error
+		wantGets []get
+	}{
+		{
+			name: "should move row to the bucket for its new value",
+			args: args{
+				table:    "imports",
+				whereCol: "importID",
+				id:       aggid,
+				cols:     []string{"status"},
+				vals:     []string{"failed"},
+				data:     []byte("file1-failed"),
+			},
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"importID", "status"}, []string{aggid, "processing"}, []byte("file1"))
+				db.Insert(context.Background(), "imports", []string{"importID", "status"}, []string{aggid2, "processing"}, []byte("file2"))
+			},
+			wantGets: []get{
+				{col: "status", id: "processing", want: [][]byte{[]byte("file2")}},
+				{col: "status", id: "failed", want: [][]byte{[]byte("file1-failed")}},
+				{col: "importID", id: aggid, want: [][]byte{[]byte("file1-failed")}},
+			},
+		},
+		{
+			name: "should keep buckets in insertion order after moving rows",
+			args: args{
+				table:    "imports",
+				whereCol: "importID",
+				id:       aggid,
+				cols:     []string{"status"},
+				vals:     []string{"failed"},
+				data:     []byte("file1"),
+			},
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"importID", "status"}, []string{aggid, "processing"}, []byte("file1"))
+				db.Insert(context.Background(), "imports", []string{"importID", "status"}, []string{aggid2, "failed"}, []byte("file2"))
+			},
+			wantGets: []get{
+				{col: "status", id: "failed", want: [][]byte{[]byte("file1"), []byte("file2")}},
+			},
+		},
+		{
+			name: "should update every matching row and index new columns",
+			args: args{
+				table:    "imports",
+				whereCol: "csid",
+				id:       csID,
+				cols:     []string{"csid", "user"},
+				vals:     []string{"new-csid", "user1"},
+				data:     []byte("moved"),
+			},
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"csid", "importID"}, []string{csID, aggid}, []byte("file1"))
+				db.Insert(context.Background(), "imports", []string{"csid", "importID"}, []string{csID, aggid2}, []byte("file2"))
+			},
+			wantGets: []get{
+				{col: "csid", id: csID, want: [][]byte{}},
+				{col: "csid", id: "new-csid", want: [][]byte{[]byte("moved"), []byte("moved")}},
+				{col: "user", id: "user1", want: [][]byte{[]byte("moved"), []byte("moved")}},
+				{col: "importID", id: aggid2, want: [][]byte{[]byte("moved")}},
+			},
+		},
+		{
+			name: "should fail due to mismatched cols and vals",
+			args: args{
+				table:    "imports",
+				whereCol: "importID",
+				id:       aggid,
+				cols:     []string{"status"},
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrArityMismatch, Table: "imports"},
+		},
+		{
+			name: "should fail due to table not existing",
+			args: args{
+				table:    "winky wonky",
+				whereCol: "importID",
+				id:       aggid,
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "winky wonky"},
+		},
+		{
+			name: "should fail due to value not existing",
+			args: args{
+				table:    "imports",
+				whereCol: "importID",
+				id:       aggid2,
+			},
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"importID"}, []string{aggid}, []byte("file1"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrValueNotFound, Table: "imports", Column: "importID", Value: aggid2},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{
+				{
+					Name:    "imports",
+					Columns: []string{"importID"},
+				},
+			})
+
+			if tc.setup != nil {
+				tc.setup(db)
+			}
+
+			gotErr := db.UpdateRow(context.Background(), tc.args.table, tc.args.whereCol, tc.args.id, tc.args.cols, tc.args.vals, tc.args.data)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, gotErr)
+				return
+			}
+
+			if !assert.Nil(t, gotErr) {
+				return
+			}
+
+			for _, g := range tc.wantGets {
+				got, err := db.Get(context.Background(), tc.args.table, g.col, g.id)
+				if !assert.Nil(t, err) {
+					return
+				}
+				assert.Equal(t, g.want, got)
+			}
+		})
+	}
+}
+
+func TestDB1_Unique(t *testing.T) {
+
+	aggid := uuid.New().String()
+	aggid2 := uuid.New().String()
+
+	testCases := []struct {
+		name      string
+		write     func(db *inmem.DB) error
+		setup     func(db *inmem.DB)
+		wantErr   error
+		wantErrIs error
+		wantRows  [][]byte
+	}{
+		{
+			name: "should insert distinct values",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid, "cs1"}, []byte("file1"))
+			},
+			write: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid2, "cs1"}, []byte("file2"))
+			},
+			wantRows: [][]byte{[]byte("file1"), []byte("file2")},
+		},
+		{
+			name: "should reject inserting a duplicate value",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid, "cs1"}, []byte("file1"))
+			},
+			write: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid, "cs1"}, []byte("file2"))
+			},
+			wantErr:   &inmem.Error{Err: inmem.ErrUniqueViolation, Table: "imports", Column: "id", Value: aggid},
+			wantErrIs: inmem.ErrUniqueViolation,
+			wantRows:  [][]byte{[]byte("file1")},
+		},
+		{
+			name: "should allow reinserting a deleted value",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid, "cs1"}, []byte("file1"))
+				db.Delete(context.Background(), "imports", "id", aggid)
+			},
+			write: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid, "cs1"}, []byte("file2"))
+			},
+			wantRows: [][]byte{[]byte("file2")},
+		},
+		{
+			name: "should allow updating a row to its own value",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid, "cs1"}, []byte("file1"))
+			},
+			write: func(db *inmem.DB) error {
+				return db.UpdateRow(context.Background(), "imports", "id", aggid, []string{"id"}, []string{aggid}, []byte("file1-updated"))
+			},
+			wantRows: [][]byte{[]byte("file1-updated")},
+		},
+		{
+			name: "should reject updating a row to another row's value",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid, "cs1"}, []byte("file1"))
+				db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid2, "cs1"}, []byte("file2"))
+			},
+			write: func(db *inmem.DB) error {
+				return db.UpdateRow(context.Background(), "imports", "id", aggid2, []string{"csid", "id"}, []string{"cs2", aggid}, []byte("file2-updated"))
+			},
+			wantErr:   &inmem.Error{Err: inmem.ErrUniqueViolation, Table: "imports", Column: "id", Value: aggid},
+			wantErrIs: inmem.ErrUniqueViolation,
+			wantRows:  [][]byte{[]byte("file1"), []byte("file2")},
+		},
+		{
+			name: "should reject updating several rows to one value",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid, "cs1"}, []byte("file1"))
+				db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid2, "cs1"}, []byte("file2"))
+			},
+			write: func(db *inmem.DB) error {
+				return db.UpdateRow(context.Background(), "imports", "csid", "cs1", []string{"id"}, []string{"same"}, []byte("updated"))
+			},
+			wantErr:   &inmem.Error{Err: inmem.ErrUniqueViolation, Table: "imports", Column: "id", Value: "same"},
+			wantErrIs: inmem.ErrUniqueViolation,
+			wantRows:  [][]byte{[]byte("file1"), []byte("file2")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{
+				{
+					Name:    "imports",
+					Columns: []string{"csid"},
+					Unique:  []string{"id"},
+				},
+			})
+
+			if tc.setup != nil {
+				tc.setup(db)
+			}
+
+			gotErr := tc.write(db)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, gotErr)
+				assert.ErrorIs(t, gotErr, tc.wantErrIs)
+			} else if !assert.Nil(t, gotErr) {
+				return
+			}
+
+			got, err := db.Query(context.Background(), "imports", nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.wantRows, got)
+		})
+	}
+}
+
+func TestDB1_GetByKey(t *testing.T) {
+
+	aggid := uuid.New().String()
+	aggid2 := uuid.New().String()
+
+	testCases := []struct {
+		name    string
+		tables  []inmem.Table
+		table   string
+		key     string
+		setup   func(db *inmem.DB)
+		want    []byte
+		wantErr error
+	}{
+		{
+			name:   "should get row by primary key",
+			tables: []inmem.Table{{Name: "imports", PrimaryKey: "id"}},
+			table:  "imports",
+			key:    aggid2,
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"id"}, []string{aggid}, []byte("file1"))
+				db.Insert(context.Background(), "imports", []string{"id"}, []string{aggid2}, []byte("file2"))
+			},
+			want: []byte("file2"),
+		},
+		{
+			name:    "should fail due to key not existing",
+			tables:  []inmem.Table{{Name: "imports", PrimaryKey: "id"}},
+			table:   "imports",
+			key:     aggid,
+			wantErr: &inmem.Error{Err: inmem.ErrValueNotFound, Table: "imports", Column: "id", Value: aggid},
+		},
+		{
+			name:    "should fail due to table having no primary key",
+			tables:  []inmem.Table{{Name: "imports"}},
+			table:   "imports",
+			key:     aggid,
+			wantErr: &inmem.Error{Err: inmem.ErrNoPrimaryKey, Table: "imports"},
+		},
+		{
+			name:    "should fail due to table not existing",
+			tables:  []inmem.Table{{Name: "imports"}},
+			table:   "winky wonky",
+			key:     aggid,
+			wantErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "winky wonky"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB(tc.tables)
+
+			if tc.setup != nil {
+				tc.setup(db)
+			}
+
+			got, gotErr := db.GetByKey(context.Background(), tc.table, tc.key)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, gotErr)
+				return
+			}
+
+			if !assert.Nil(t, gotErr) {
+				return
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB1_Upsert(t *testing.T) {
+
+	aggid := uuid.New().String()
+	aggid2 := uuid.New().String()
+
+	type get struct {
+		col  string
+		id   string
+		want [][]byte
+	}
+
+	testCases := []struct {
+		name     string
+		tables   []inmem.Table
+		table    string
+		cols     []string
+		vals     []string
+		data     []byte
+		setup    func(db *inmem.DB)
+		wantErr  error
+		wantGets []get
+	}{
+		{
+			name:   "should insert a new row",
+			tables: []inmem.Table{{Name: "imports", PrimaryKey: "id"}},
+			table:  "imports",
+			cols:   []string{"id", "status"},
+			vals:   []string{aggid, "processing"},
+			data:   []byte("file1"),
+			wantGets: []get{
+				{col: "id", id: aggid, want: [][]byte{[]byte("file1")}},
+				{col: "status", id: "processing", want: [][]byte{[]byte("file1")}},
+			},
+		},
+		{
+			name:   "should replace an existing row and keep its order",
+			tables: []inmem.Table{{Name: "imports", PrimaryKey: "id"}},
+			table:  "imports",
+			cols:   []string{"id", "status"},
+			vals:   []string{aggid, "succeeded"},
+			data:   []byte("file1-done"),
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"id", "status", "user"}, []string{aggid, "processing", "a"}, []byte("file1"))
+				db.Insert(context.Background(), "imports", []string{"id", "status"}, []string{aggid2, "succeeded"}, []byte("file2"))
+			},
+			wantGets: []get{
+				{col: "id", id: aggid, want: [][]byte{[]byte("file1-done")}},
+				{col: "status", id: "processing", want: [][]byte{}},
+				{col: "status", id: "succeeded", want: [][]byte{[]byte("file1-done"), []byte("file2")}},
+				{col: "user", id: "a", want: [][]byte{}},
+			},
+		},
+		{
+			name:   "should reject replacing a row with a duplicate unique value",
+			tables: []inmem.Table{{Name: "imports", PrimaryKey: "id", Unique: []string{"fileName"}}},
+			table:  "imports",
+			cols:   []string{"id", "fileName"},
+			vals:   []string{aggid, "file2"},
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"id", "fileName"}, []string{aggid, "file1"}, []byte("file1"))
+				db.Insert(context.Background(), "imports", []string{"id", "fileName"}, []string{aggid2, "file2"}, []byte("file2"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrUniqueViolation, Table: "imports", Column: "fileName", Value: "file2"},
+		},
+		{
+			name:    "should fail due to missing primary key",
+			tables:  []inmem.Table{{Name: "imports", PrimaryKey: "id"}},
+			table:   "imports",
+			cols:    []string{"status"},
+			vals:    []string{"processing"},
+			wantErr: &inmem.Error{Err: inmem.ErrMissingArgument, Table: "imports", Column: "id"},
+		},
+		{
+			name:    "should fail due to table having no primary key",
+			tables:  []inmem.Table{{Name: "imports"}},
+			table:   "imports",
+			cols:    []string{"id"},
+			vals:    []string{aggid},
+			wantErr: &inmem.Error{Err: inmem.ErrNoPrimaryKey, Table: "imports"},
+		},
+		{
+			name:    "should fail due to mismatched cols and vals",
+			tables:  []inmem.Table{{Name: "imports", PrimaryKey: "id"}},
+			table:   "imports",
+			cols:    []string{"id"},
+			wantErr: &inmem.Error{Err: inmem.ErrArityMismatch, Table: "imports"},
+		},
+		{
+			name:    "should fail due to table not existing",
+			tables:  []inmem.Table{{Name: "imports", PrimaryKey: "id"}},
+			table:   "winky wonky",
+			wantErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "winky wonky"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB(tc.tables)
+
+			if tc.setup != nil {
+				tc.setup(db)
+			}
+
+			gotErr := db.Upsert(context.Background(), tc.table, tc.cols, tc.vals, tc.data)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, gotErr)
+				return
+			}
+
+			if !assert.Nil(t, gotErr) {
+				return
+			}
+
+			for _, g := range tc.wantGets {
+				got, err := db.Get(context.Background(), tc.table, g.col, g.id)
+				if !assert.Nil(t, err) {
+					return
+				}
+				assert.Equal(t, g.want, got)
+			}
+		})
+	}
+}
+
+func TestDB1_Strict(t *testing.T) {
+
+	aggid := uuid.New().String()
+
+	testCases := []struct {
+		name    string
+		tables  []inmem.Table
+		opts    []inmem.Option
+		op      func(db *inmem.DB) error
+		wantErr error
+	}{
+		{
+			name:   "should insert declared columns on a strict table",
+			tables: []inmem.Table{{Name: "imports", Columns: []string{"csid"}, PrimaryKey: "id", Strict: true}},
+			op: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{aggid, "cs1"}, []byte("file1"))
+			},
+		},
+		{
+			name:   "should reject inserting an undeclared column on a strict table",
+			tables: []inmem.Table{{Name: "imports", Columns: []string{"csid"}, Strict: true}},
+			op: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"csdi"}, []string{"cs1"}, []byte("file1"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotDeclared, Table: "imports", Column: "csdi"},
+		},
+		{
+			name:   "should reject inserting an undeclared column with the strict option",
+			tables: []inmem.Table{{Name: "imports", Columns: []string{"csid"}}},
+			opts:   []inmem.Option{inmem.WithStrictSchema()},
+			op: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"csdi"}, []string{"cs1"}, []byte("file1"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotDeclared, Table: "imports", Column: "csdi"},
+		},
+		{
+			name:   "should reject getting an undeclared column",
+			tables: []inmem.Table{{Name: "imports", Columns: []string{"csid"}, Strict: true}},
+			op: func(db *inmem.DB) error {
+				_, err := db.Get(context.Background(), "imports", "csdi", "cs1")
+				return err
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotDeclared, Table: "imports", Column: "csdi"},
+		},
+		{
+			name:   "should reject updating an undeclared column",
+			tables: []inmem.Table{{Name: "imports", Columns: []string{"csid"}, Strict: true}},
+			op: func(db *inmem.DB) error {
+				return db.Update(context.Background(), "imports", "csdi", "cs1", []byte("file1"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotDeclared, Table: "imports", Column: "csdi"},
+		},
+		{
+			name:   "should reject re-indexing an undeclared column",
+			tables: []inmem.Table{{Name: "imports", Columns: []string{"csid"}, Strict: true}},
+			op: func(db *inmem.DB) error {
+				if err := db.Insert(context.Background(), "imports", []string{"csid"}, []string{"cs1"}, []byte("file1")); err != nil {
+					return err
+				}
+				return db.UpdateRow(context.Background(), "imports", "csid", "cs1", []string{"csdi"}, []string{"cs2"}, []byte("file1"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotDeclared, Table: "imports", Column: "csdi"},
+		},
+		{
+			name:   "should keep creating columns on tables that aren't strict",
+			tables: []inmem.Table{{Name: "imports", Columns: []string{"csid"}}},
+			op: func(db *inmem.DB) error {
+				if err := db.Insert(context.Background(), "imports", []string{"csdi"}, []string{"cs1"}, []byte("file1")); err != nil {
+					return err
+				}
+				_, err := db.Get(context.Background(), "imports", "csdi", "cs1")
+				return err
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB(tc.tables, tc.opts...)
+
+			gotErr := tc.op(db)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, gotErr)
+				return
+			}
+
+			assert.Nil(t, gotErr)
+		})
+	}
+}
+
+func TestDB1_Context(t *testing.T) {
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	testCases := []struct {
+		name    string
+		opts    []inmem.Option
+		op      func(db *inmem.DB) error
+		wantErr error
+	}{
+		{
+			name: "should not get with a canceled context",
+			op: func(db *inmem.DB) error {
+				_, err := db.Get(canceled, "imports", "id", "import1")
+				return err
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name: "should not query with an expired context",
+			op: func(db *inmem.DB) error {
+				_, err := db.Query(expired, "imports", inmem.Not(inmem.Eq("id", "import1")))
+				return err
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "should not insert with a canceled context",
+			op: func(db *inmem.DB) error {
+				return db.Insert(canceled, "imports", []string{"id"}, []string{"import2"}, []byte("import2"))
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name: "should not update with an expired context",
+			op: func(db *inmem.DB) error {
+				return db.Update(expired, "imports", "id", "import1", []byte("import1-v2"))
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "should not delete with a canceled context",
+			op: func(db *inmem.DB) error {
+				return db.Delete(canceled, "imports", "id", "import1")
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name: "should not begin with a canceled context",
+			op: func(db *inmem.DB) error {
+				_, err := db.Begin(canceled)
+				return err
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name: "should not run a statement in a transaction with a canceled context",
+			op: func(db *inmem.DB) error {
+				tx, err := db.Begin(context.Background())
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+
+				return tx.Insert(canceled, "imports", []string{"id"}, []string{"import2"}, []byte("import2"))
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name: "should not commit once the context the transaction began with is canceled",
+			op: func(db *inmem.DB) error {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				tx, err := db.Begin(ctx)
+				if err != nil {
+					return err
+				}
+
+				if err := tx.Insert(context.Background(), "imports", []string{"id"}, []string{"import2"}, []byte("import2")); err != nil {
+					return err
+				}
+
+				cancel()
+				return tx.Commit()
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name: "should complete calls well within the call timeout",
+			opts: []inmem.Option{inmem.WithCallTimeout(time.Minute)},
+			op: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"id"}, []string{"import2"}, []byte("import2"))
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{{Name: "imports", Columns: []string{"id"}}}, tc.opts...)
+			if !assert.Nil(t, db.Insert(context.Background(), "imports", []string{"id"}, []string{"import1"}, []byte("import1"))) {
+				return
+			}
+
+			gotErr := tc.op(db)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, gotErr)
+
+				// nothing was written
+				rows, err := db.Query(context.Background(), "imports", nil)
+				assert.Nil(t, err)
+				assert.Equal(t, [][]byte{[]byte("import1")}, rows)
+				return
+			}
+
+			assert.Nil(t, gotErr)
+		})
+	}
+}
+
+func TestDB1_Errors(t *testing.T) {
+
+	testCases := []struct {
+		name    string
+		op      func(db *inmem.DB) error
+		wantIs  error
+		wantErr inmem.Error
+	}{
+		{
+			name: "should identify a missing table",
+			op: func(db *inmem.DB) error {
+				_, err := db.Get(context.Background(), "winky wonky", "id", "import1")
+				return err
+			},
+			wantIs:  inmem.ErrTableNotFound,
+			wantErr: inmem.Error{Err: inmem.ErrTableNotFound, Table: "winky wonky"},
+		},
+		{
+			name: "should identify a missing column",
+			op: func(db *inmem.DB) error {
+				_, err := db.Query(context.Background(), "imports", inmem.Eq("winky wonky", "import1"))
+				return err
+			},
+			wantIs:  inmem.ErrColumnNotFound,
+			wantErr: inmem.Error{Err: inmem.ErrColumnNotFound, Table: "imports", Column: "winky wonky"},
+		},
+		{
+			name: "should identify a missing value",
+			op: func(db *inmem.DB) error {
+				return db.Delete(context.Background(), "imports", "id", "import2")
+			},
+			wantIs:  inmem.ErrValueNotFound,
+			wantErr: inmem.Error{Err: inmem.ErrValueNotFound, Table: "imports", Column: "id", Value: "import2"},
+		},
+		{
+			name: "should identify mismatched cols and vals",
+			op: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import2"}, []byte("import2"))
+			},
+			wantIs:  inmem.ErrArityMismatch,
+			wantErr: inmem.Error{Err: inmem.ErrArityMismatch, Table: "imports"},
+		},
+		{
+			name: "should identify a duplicate value",
+			op: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"id"}, []string{"import1"}, []byte("import1-again"))
+			},
+			wantIs:  inmem.ErrUniqueViolation,
+			wantErr: inmem.Error{Err: inmem.ErrUniqueViolation, Table: "imports", Column: "id", Value: "import1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{{Name: "imports", Unique: []string{"id"}}})
+			if !assert.Nil(t, db.Insert(context.Background(), "imports", []string{"id"}, []string{"import1"}, []byte("import1"))) {
+				return
+			}
+
+			gotErr := tc.op(db)
+			assert.True(t, errors.Is(gotErr, tc.wantIs))
+
+			var dbErr *inmem.Error
+			if assert.True(t, errors.As(gotErr, &dbErr)) {
+				assert.Equal(t, tc.wantErr, *dbErr)
+			}
+		})
+	}
+}
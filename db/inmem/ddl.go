@@ -0,0 +1,225 @@
+package inmem
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Index describes an index built on an existing column with CreateIndex
+type Index struct {
+	Column string
+	// Ordered indexes the column in sorted order as well, as for Table.Ordered
+	Ordered bool
+	// Unique adds a unique constraint on the column, as for Table.Unique
+	Unique bool
+}
+
+// Schema changes take effect immediately for every caller, including transactions that are already open; they are not
+// part of any snapshot. Each one holds the lock of the table it changes, so it waits for calls and commits on that table
+// to finish and they in turn wait for it. Transactions holding writes to a table that is dropped fail to commit
+
+// CreateTable adds a table to the DB. It fails with ErrTableExists if there is already a table called tbl.Name
+func (db *DB) CreateTable(ctx context.Context, tbl Table) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if db.strict {
+		tbl.Strict = true
+	}
+
+	db.tablesMu.Lock()
+	defer db.tablesMu.Unlock()
+
+	if db.lookup(tbl.Name) != nil {
+		return &Error{Err: ErrTableExists, Table: tbl.Name}
+	}
+	if err := checkEviction(tbl); err != nil {
+		return err
+	}
+
+	return db.changeSchema(&logRecord{kind: recordCreateTable, def: tbl}, func() {
+		db.mu.Lock()
+		db.tables[tbl.Name] = newTable(tbl)
+		db.mu.Unlock()
+	})
+}
+
+// DropTable removes a table and every row in it
+func (db *DB) DropTable(ctx context.Context, table string) error {
+	ctx, cancel := db.callContext(ctx)
+	defer cancel()
+
+	t, unlock, err := db.alter(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	db.tablesMu.Lock()
+	defer db.tablesMu.Unlock()
+
+	return db.changeSchema(&logRecord{kind: recordDropTable, table: table}, func() {
+		db.dropTable(t)
+	})
+}
+
+// AddColumn adds an indexed column to a table, declaring it on strict tables. Existing rows have no value for it until
+// they are written with one. It fails with ErrColumnExists if the table already has the column
+func (db *DB) AddColumn(ctx context.Context, table string, col string) error {
+	ctx, cancel := db.callContext(ctx)
+	defer cancel()
+
+	t, unlock, err := db.alter(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, found := t.rows[colName(col)]; found {
+		return &Error{Err: ErrColumnExists, Table: table, Column: col}
+	}
+
+	return db.changeSchema(&logRecord{kind: recordAddColumn, table: table, column: col}, func() {
+		t.addColumns([]string{col})
+	})
+}
+
+// DropColumn removes a column and its indexes from a table, along with every row's value for it. The primary key
+// can't be dropped
+func (db *DB) DropColumn(ctx context.Context, table string, col string) error {
+	ctx, cancel := db.callContext(ctx)
+	defer cancel()
+
+	t, unlock, err := db.alter(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c := colName(col)
+	if _, err := t.column(c); err != nil {
+		return err
+	}
+
+	if c == t.pk {
+		return &Error{Err: ErrPrimaryKeyColumn, Table: table, Column: col}
+	}
+
+	return db.changeSchema(&logRecord{kind: recordDropColumn, table: table, column: col}, func() {
+		t.dropColumn(c)
+	})
+}
+
+// CreateIndex builds an ordered index or adds a unique constraint on an existing column, backfilling it from the rows
+// already in the table. Adding a unique constraint fails with ErrUniqueViolation if two rows already share a value
+func (db *DB) CreateIndex(ctx context.Context, table string, idx Index) error {
+	ctx, cancel := db.callContext(ctx)
+	defer cancel()
+
+	t, unlock, err := db.alter(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c := colName(idx.Column)
+	col, err := t.column(c)
+	if err != nil {
+		return err
+	}
+
+	if idx.Unique && !t.unique[c] {
+		// every version of the table is published while its lock is held, so the latest commit is complete
+		latest, now := atomic.LoadUint64(&db.clock), db.now()
+		for v, bucket := range col {
+			holders := 0
+			for _, rid := range bucket {
+				if ver := t.visible(rid, latest); ver != nil && !ver.expired(now) && ver.vals[c] == v {
+					holders++
+				}
+			}
+
+			if holders > 1 {
+				return uniqueViolation(table, c, v)
+			}
+		}
+	}
+
+	return db.changeSchema(&logRecord{kind: recordCreateIndex, table: table, index: idx}, func() {
+		t.createIndex(idx)
+	})
+}
+
+// alter returns table with its write lock held, and the func to release the lock
+func (db *DB) alter(ctx context.Context, name string) (*table, func(), error) {
+	t := db.lookup(name)
+	if t == nil {
+		return nil, nil, &Error{Err: ErrTableNotFound, Table: name}
+	}
+
+	if err := t.mu.lock(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	if t.dropped {
+		t.mu.unlock()
+		return nil, nil, &Error{Err: ErrTableNotFound, Table: name}
+	}
+
+	return t, t.mu.unlock, nil
+}
+
+// dropTable removes t from the DB. t must be write locked
+func (db *DB) dropTable(t *table) {
+	db.mu.Lock()
+	delete(db.tables, t.name)
+	db.mu.Unlock()
+
+	t.dropped = true
+}
+
+// dropColumn removes column c and every row's value for it
+func (t *table) dropColumn(c colName) {
+	delete(t.rows, c)
+	delete(t.ordered, c)
+	delete(t.unique, c)
+
+	for _, rec := range t.rowData {
+		for ver := rec.versions; ver != nil; ver = ver.prev {
+			if v, found := ver.vals[c]; found {
+				if ver == rec.versions {
+					t.liveBytes -= int64(len(c) + len(v))
+				}
+				ver.vals = without(ver.vals, c)
+			}
+		}
+	}
+}
+
+// createIndex builds idx from the rows in the table. Unique constraints must already have been checked
+func (t *table) createIndex(idx Index) {
+	c := colName(idx.Column)
+	if idx.Unique {
+		t.unique[c] = true
+	}
+
+	if _, found := t.ordered[c]; idx.Ordered && !found {
+		sl := newSkiplist()
+		for v := range t.rows[c] {
+			sl.insert(v)
+		}
+		t.ordered[c] = sl
+	}
+}
+
+// without returns a copy of vals without column c
+func without(vals map[colName]val, c colName) map[colName]val {
+	cp := make(map[colName]val, len(vals))
+	for cn, cv := range vals {
+		if cn != c {
+			cp[cn] = cv
+		}
+	}
+	return cp
+}
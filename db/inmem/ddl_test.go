@@ -0,0 +1,240 @@
+package inmem_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_DDL(t *testing.T) {
+
+	testCases := []struct {
+		name string
+		// ddl runs against a DB holding imports import1 (csid cs1) and import2 (csid cs2)
+		ddl     func(db *inmem.DB) error
+		wantErr error
+		read    func(db *inmem.DB) ([][]byte, error)
+		want    [][]byte
+		// wantReadErr is the error read should fail with instead of returning want
+		wantReadErr error
+	}{
+		{
+			name: "should create a table",
+			ddl: func(db *inmem.DB) error {
+				if err := db.CreateTable(context.Background(), inmem.Table{Name: "profiles", PrimaryKey: "id"}); err != nil {
+					return err
+				}
+				return db.Insert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1"))
+			},
+			read: func(db *inmem.DB) ([][]byte, error) {
+				data, err := db.GetByKey(context.Background(), "profiles", "user1")
+				return [][]byte{data}, err
+			},
+			want: [][]byte{[]byte("profile1")},
+		},
+		{
+			name: "should fail creating a table that exists",
+			ddl: func(db *inmem.DB) error {
+				return db.CreateTable(context.Background(), inmem.Table{Name: "imports"})
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrTableExists, Table: "imports"},
+		},
+		{
+			name: "should drop a table",
+			ddl: func(db *inmem.DB) error {
+				return db.DropTable(context.Background(), "imports")
+			},
+			read: func(db *inmem.DB) ([][]byte, error) {
+				return db.Get(context.Background(), "imports", "csid", "cs1")
+			},
+			wantReadErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "imports"},
+		},
+		{
+			name: "should recreate a dropped table empty",
+			ddl: func(db *inmem.DB) error {
+				if err := db.DropTable(context.Background(), "imports"); err != nil {
+					return err
+				}
+				return db.CreateTable(context.Background(), inmem.Table{Name: "imports", Columns: []string{"csid"}})
+			},
+			read: func(db *inmem.DB) ([][]byte, error) {
+				return db.Get(context.Background(), "imports", "csid", "cs1")
+			},
+			want: [][]byte{},
+		},
+		{
+			name: "should fail dropping a table that doesn't exist",
+			ddl: func(db *inmem.DB) error {
+				return db.DropTable(context.Background(), "winky wonky")
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "winky wonky"},
+		},
+		{
+			name: "should add a column to a strict table",
+			ddl: func(db *inmem.DB) error {
+				if err := db.AddColumn(context.Background(), "imports", "status"); err != nil {
+					return err
+				}
+				return db.UpdateRow(context.Background(), "imports", "id", "import1", []string{"status"}, []string{"failed"}, []byte("import1-failed"))
+			},
+			read: func(db *inmem.DB) ([][]byte, error) {
+				return db.Get(context.Background(), "imports", "status", "failed")
+			},
+			want: [][]byte{[]byte("import1-failed")},
+		},
+		{
+			name: "should fail adding a column that exists",
+			ddl: func(db *inmem.DB) error {
+				return db.AddColumn(context.Background(), "imports", "csid")
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrColumnExists, Table: "imports", Column: "csid"},
+		},
+		{
+			name: "should drop a column",
+			ddl: func(db *inmem.DB) error {
+				return db.DropColumn(context.Background(), "imports", "csid")
+			},
+			read: func(db *inmem.DB) ([][]byte, error) {
+				return db.Get(context.Background(), "imports", "csid", "cs1")
+			},
+			wantReadErr: &inmem.Error{Err: inmem.ErrColumnNotDeclared, Table: "imports", Column: "csid"},
+		},
+		{
+			name: "should not bring back dropped values when the column is added again",
+			ddl: func(db *inmem.DB) error {
+				if err := db.DropColumn(context.Background(), "imports", "csid"); err != nil {
+					return err
+				}
+				if err := db.AddColumn(context.Background(), "imports", "csid"); err != nil {
+					return err
+				}
+				return db.UpdateRow(context.Background(), "imports", "id", "import2", []string{"csid"}, []string{"cs3"}, []byte("import2"))
+			},
+			read: func(db *inmem.DB) ([][]byte, error) {
+				return db.Query(context.Background(), "imports", inmem.Not(inmem.Eq("csid", "cs3")))
+			},
+			want: [][]byte{[]byte("import1")},
+		},
+		{
+			name: "should fail dropping the primary key",
+			ddl: func(db *inmem.DB) error {
+				return db.DropColumn(context.Background(), "imports", "id")
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrPrimaryKeyColumn, Table: "imports", Column: "id"},
+		},
+		{
+			name: "should backfill an ordered index",
+			ddl: func(db *inmem.DB) error {
+				return db.CreateIndex(context.Background(), "imports", inmem.Index{Column: "csid", Ordered: true})
+			},
+			read: func(db *inmem.DB) ([][]byte, error) {
+				return db.Query(context.Background(), "imports", inmem.Gt("csid", "cs1"))
+			},
+			want: [][]byte{[]byte("import2")},
+		},
+		{
+			name: "should enforce a unique index on existing rows",
+			ddl: func(db *inmem.DB) error {
+				if err := db.CreateIndex(context.Background(), "imports", inmem.Index{Column: "csid", Unique: true}); err != nil {
+					return err
+				}
+				return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import3", "cs1"}, []byte("import3"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrUniqueViolation, Table: "imports", Column: "csid", Value: "cs1"},
+		},
+		{
+			name: "should fail a unique index existing rows already break",
+			ddl: func(db *inmem.DB) error {
+				if err := db.UpdateRow(context.Background(), "imports", "id", "import2", []string{"csid"}, []string{"cs1"}, []byte("import2")); err != nil {
+					return err
+				}
+				return db.CreateIndex(context.Background(), "imports", inmem.Index{Column: "csid", Unique: true})
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrUniqueViolation, Table: "imports", Column: "csid", Value: "cs1"},
+		},
+		{
+			name: "should fail committing writes to a dropped table",
+			ddl: func(db *inmem.DB) error {
+				tx, err := db.Begin(context.Background())
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+
+				if err := tx.Insert(context.Background(), "imports", []string{"id"}, []string{"import3"}, []byte("import3")); err != nil {
+					return err
+				}
+				if err := db.DropTable(context.Background(), "imports"); err != nil {
+					return err
+				}
+				return tx.Commit()
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "imports"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{{Name: "imports", Columns: []string{"csid"}, PrimaryKey: "id", Strict: true}})
+			for i := 1; i <= 2; i++ {
+				id := strconv.Itoa(i)
+				if !assert.Nil(t, db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import" + id, "cs" + id}, []byte("import"+id))) {
+					return
+				}
+			}
+
+			gotErr := tc.ddl(db)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, gotErr)
+				return
+			}
+			if !assert.Nil(t, gotErr) {
+				return
+			}
+
+			got, err := tc.read(db)
+			if tc.wantReadErr != nil {
+				assert.Equal(t, tc.wantReadErr, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB_DDLConcurrent(t *testing.T) {
+
+	db := inmem.NewDB([]inmem.Table{{Name: "imports", Columns: []string{"csid"}}})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				id := strconv.Itoa(w*100 + i)
+				db.Insert(context.Background(), "imports", []string{"csid", "status"}, []string{"cs" + id, "pending"}, []byte(id))
+				db.Query(context.Background(), "imports", inmem.Not(inmem.Eq("csid", "cs0")))
+			}
+		}(w)
+	}
+
+	for i := 0; i < 20; i++ {
+		table := "profiles" + strconv.Itoa(i)
+		assert.Nil(t, db.CreateTable(context.Background(), inmem.Table{Name: table}))
+		assert.Nil(t, db.CreateIndex(context.Background(), "imports", inmem.Index{Column: "csid", Ordered: true}))
+		db.DropColumn(context.Background(), "imports", "status")
+		assert.Nil(t, db.DropTable(context.Background(), table))
+	}
+	wg.Wait()
+
+	rows, err := db.Query(context.Background(), "imports", inmem.Prefix("csid", "cs"))
+	assert.Nil(t, err)
+	assert.Len(t, rows, 400)
+}
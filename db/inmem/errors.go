@@ -0,0 +1,104 @@
+package inmem
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DB errors. Errors returned by the DB wrap these so callers can check for them with errors.Is
+var (
+	ErrTableNotFound     = errors.New("table not found")
+	ErrTableExists       = errors.New("table already exists")
+	ErrColumnExists      = errors.New("column already exists")
+	ErrPrimaryKeyColumn  = errors.New("column is the primary key")
+	ErrColumnNotFound    = errors.New("column not found")
+	ErrColumnNotDeclared = errors.New("column not declared")
+	ErrColumnNotOrdered  = errors.New("column not ordered")
+	ErrValueNotFound     = errors.New("value not found")
+	ErrArityMismatch     = errors.New("length of cols must match vals")
+	ErrMissingArgument   = errors.New("missing argument")
+	ErrNoPrimaryKey      = errors.New("table has no primary key")
+	ErrUniqueViolation   = errors.New("unique constraint violated")
+	ErrTxDone            = errors.New("transaction has already been committed or rolled back")
+	ErrConflict          = errors.New("transaction conflict")
+	// ErrBadSnapshot is returned when loading a snapshot this version can't read, or that is corrupt
+	ErrBadSnapshot = errors.New("bad snapshot")
+	// ErrBadLog is returned by Open when the log can't be replayed. A torn record at the end of the log isn't an
+	// error; it is cut off
+	ErrBadLog = errors.New("bad write-ahead log")
+	// ErrClosed is returned by writes to a DB whose log has been closed
+	ErrClosed = errors.New("db is closed")
+	// ErrUnknownEviction is returned by CreateTable, and by LoadSnapshot, Open and Recover when restoring, for a table
+	// whose eviction policy isn't registered. NewDB panics with it
+	ErrUnknownEviction = errors.New("unknown eviction policy")
+	// ErrNotRetained is returned by Recover when the checkpoints and log kept don't reach back to the target
+	ErrNotRetained = errors.New("recovery target is older than the retained log")
+	// ErrBadCursor is returned by QueryPage for a cursor it didn't return for the table
+	ErrBadCursor = errors.New("bad cursor")
+	// ErrStopScan can be returned by a Scan callback to stop the scan early. Scan then returns nil
+	ErrStopScan = errors.New("stop scan")
+	// ErrNotNumeric is returned by Sum, Min and Max when a column holds a value that isn't a number
+	ErrNotNumeric = errors.New("value is not a number")
+)
+
+// Error is returned by DB and Tx calls that fail on a particular table, column or value. Err is one of the DB errors
+// above, so errors.Is works as usual, and errors.As gives access to what the call failed on. Fields that don't apply
+// to the failure are left empty
+// EXAMPLE:
+//
+//	var dbErr *inmem.Error
+//	if errors.As(err, &dbErr) && errors.Is(err, inmem.ErrValueNotFound) {
+//		log.Printf("no row in %s where %s is %s", dbErr.Table, dbErr.Column, dbErr.Value)
+//	}
+type Error struct {
+	Err    error
+	Table  string
+	Column string
+	Value  string
+}
+
+func (e *Error) Error() string {
+	switch e.Err {
+	case ErrTableNotFound:
+		return fmt.Sprintf("table %q not found", e.Table)
+	case ErrTableExists:
+		return fmt.Sprintf("table %q already exists", e.Table)
+	case ErrColumnExists:
+		return fmt.Sprintf("column %q already exists on table %q", e.Column, e.Table)
+	case ErrPrimaryKeyColumn:
+		return fmt.Sprintf("column %q is the primary key of table %q", e.Column, e.Table)
+	case ErrColumnNotFound:
+		return fmt.Sprintf("column %q not found on table %q", e.Column, e.Table)
+	case ErrColumnNotDeclared:
+		return fmt.Sprintf("column %q is not declared on table %q", e.Column, e.Table)
+	case ErrColumnNotOrdered:
+		return fmt.Sprintf("column %q is not ordered on table %q", e.Column, e.Table)
+	case ErrValueNotFound:
+		return fmt.Sprintf("value %q not found in column %q on table %q", e.Value, e.Column, e.Table)
+	case ErrArityMismatch:
+		return fmt.Sprintf("%s writing table %q", e.Err, e.Table)
+	case ErrMissingArgument:
+		if e.Column != "" {
+			return fmt.Sprintf("column %q must be provided writing table %q", e.Column, e.Table)
+		}
+		return fmt.Sprintf("column and value must be provided writing table %q", e.Table)
+	case ErrNoPrimaryKey:
+		return fmt.Sprintf("table %q has no primary key", e.Table)
+	case ErrUniqueViolation:
+		return fmt.Sprintf("%s: column %q on table %q already has value %q", e.Err, e.Column, e.Table, e.Value)
+	case ErrUnknownEviction:
+		return fmt.Sprintf("%s %q for table %q", e.Err, e.Value, e.Table)
+	case ErrNotNumeric:
+		return fmt.Sprintf("value %q in column %q on table %q is not a number", e.Value, e.Column, e.Table)
+	case ErrBadCursor:
+		return fmt.Sprintf("%s %q for table %q", e.Err, e.Value, e.Table)
+	case ErrConflict:
+		return fmt.Sprintf("%s: a row in table %q was changed by another transaction", e.Err, e.Table)
+	}
+
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
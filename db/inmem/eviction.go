@@ -0,0 +1,365 @@
+package inmem
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+)
+
+// Eviction policies built into the DB, for Table.Eviction
+const (
+	// LRU evicts the row least recently read or written
+	LRU = "lru"
+	// LFU evicts the row read or written the fewest times, the least recently used of them first
+	LFU = "lfu"
+)
+
+// Evictor decides which rows a table with a row or byte limit evicts. It is told when rows are added, used and removed,
+// by key, and is asked for a victim whenever a commit would take the table over its limits. Calls are serialized, so
+// an Evictor doesn't need its own locking
+type Evictor interface {
+	// Add starts tracking a new row
+	Add(key uint64)
+	// Access records a read or write of a row. Keys that aren't tracked yet are added
+	Access(key uint64)
+	// Remove stops tracking a row
+	Remove(key uint64)
+	// Victim returns the row to evict next, passing over the rows skip returns true for. It returns false if there is
+	// no row to evict
+	Victim(skip func(key uint64) bool) (uint64, bool)
+}
+
+var (
+	evictionMu       sync.RWMutex
+	evictionPolicies = map[string]func() Evictor{
+		LRU: func() Evictor { return newLRU() },
+		LFU: func() Evictor { return newLFU() },
+	}
+)
+
+// RegisterEvictionPolicy makes a policy available to Table.Eviction under name, replacing any policy already
+// registered under it. newEvictor is called once for every table using the policy. Policies must be registered before
+// the tables using them are created or restored
+func RegisterEvictionPolicy(name string, newEvictor func() Evictor) {
+	evictionMu.Lock()
+	defer evictionMu.Unlock()
+
+	evictionPolicies[name] = newEvictor
+}
+
+// evictionPolicy returns the policy registered under name, LRU for an empty name
+func evictionPolicy(name string) (func() Evictor, bool) {
+	if name == "" {
+		name = LRU
+	}
+
+	evictionMu.RLock()
+	defer evictionMu.RUnlock()
+
+	newEvictor, found := evictionPolicies[name]
+	return newEvictor, found
+}
+
+// checkEviction returns an error wrapping ErrUnknownEviction if tbl's eviction policy isn't registered
+func checkEviction(tbl Table) error {
+	if _, found := evictionPolicy(tbl.Eviction); !found {
+		return &Error{Err: ErrUnknownEviction, Table: tbl.Name, Value: tbl.Eviction}
+	}
+	return nil
+}
+
+// Evicted is a row a table evicted to stay within its limits, as passed to the WithOnEvict callback
+type Evicted struct {
+	Table string
+	// Cols holds the row's indexed values by column
+	Cols map[string]string
+	Data []byte
+}
+
+// WithOnEvict makes the DB call fn with every row it evicts. fn is called once the commit that evicted the rows has
+// been applied and its locks released, on the goroutine that committed, so it can log the rows or write them back
+// elsewhere
+func WithOnEvict(fn func(Evicted)) Option {
+	return func(db *DB) {
+		db.onEvict = fn
+	}
+}
+
+// onEvicted passes rows evicted by a commit to the DB's callback, if it has one
+func (db *DB) onEvicted(rows []Evicted) {
+	if db.onEvict == nil {
+		return
+	}
+	for _, r := range rows {
+		db.onEvict(r)
+	}
+}
+
+// evictor tracks the rows of a table with limits for its Evictor. Readers record accesses while only holding the
+// table's read lock, so the Evictor is guarded by its own mutex
+type evictor struct {
+	mu       sync.Mutex
+	policy   Evictor
+	maxRows  int
+	maxBytes int64
+}
+
+// newEvictor returns the evictor for a table defined by tbl, or nil if the table has no limits. The policy must have
+// been checked with checkEviction
+func newEvictor(tbl Table) *evictor {
+	if tbl.MaxRows <= 0 && tbl.MaxBytes <= 0 {
+		return nil
+	}
+
+	newPolicy, _ := evictionPolicy(tbl.Eviction)
+
+	return &evictor{policy: newPolicy(), maxRows: tbl.MaxRows, maxBytes: tbl.MaxBytes}
+}
+
+func (e *evictor) add(rid rowID) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.policy.Add(uint64(rid))
+}
+
+func (e *evictor) access(rid rowID) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.policy.Access(uint64(rid))
+}
+
+func (e *evictor) remove(rid rowID) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.policy.Remove(uint64(rid))
+}
+
+// over reports whether a table holding rows rows of bytes bytes is over the limits
+func (e *evictor) over(rows int, bytes int64) bool {
+	return e.maxRows > 0 && rows > e.maxRows || e.maxBytes > 0 && bytes > e.maxBytes
+}
+
+// size is roughly the memory a version holds: its data and indexed values
+func (ver *version) size() int64 {
+	n := int64(len(ver.data))
+	for c, v := range ver.vals {
+		n += int64(len(c) + len(v))
+	}
+	return n
+}
+
+// latest returns the newest version of row rid, or nil if it is deleted or doesn't exist
+func (t *table) latest(rid rowID) *version {
+	rec, found := t.rowData[rid]
+	if !found || rec.versions.deleted {
+		return nil
+	}
+	return rec.versions
+}
+
+// access records that the transaction read rows, for tables with limits. Rows it inserted aren't tracked until they
+// are committed, and rows deleted since its snapshot aren't tracked again
+func (v *view) access(rowIDs []rowID) {
+	if v.t.evict == nil {
+		return
+	}
+	for _, rid := range rowIDs {
+		if rid < pendingRowID && v.t.latest(rid) != nil {
+			v.t.evict.access(rid)
+		}
+	}
+}
+
+// evict adds deletes to the transaction's writes for the rows the table evicts to stay within its limits once the
+// writes are applied, returning the evicted rows. Rows the transaction writes are never evicted. The writes must have
+// been resolved and the table must be locked
+func (v *view) evict() []Evicted {
+	t := v.t
+	if t.evict == nil {
+		return nil
+	}
+
+	rows, bytes := t.liveRows, t.liveBytes
+	for rid, ver := range v.writes {
+		if old := t.latest(rid); old != nil {
+			rows--
+			bytes -= old.size()
+		}
+		if ver != nil {
+			rows++
+			bytes += ver.size()
+		}
+	}
+
+	var evicted []Evicted
+	skip := func(key uint64) bool {
+		_, writing := v.writes[rowID(key)]
+		return writing
+	}
+	for t.evict.over(rows, bytes) {
+		t.evict.mu.Lock()
+		key, found := t.evict.policy.Victim(skip)
+		if found {
+			t.evict.policy.Remove(key)
+		}
+		t.evict.mu.Unlock()
+
+		if !found {
+			break
+		}
+
+		rid := rowID(key)
+		ver := t.latest(rid)
+		if ver == nil {
+			continue
+		}
+
+		v.writes[rid] = nil
+		rows--
+		bytes -= ver.size()
+
+		cols := make(map[string]string, len(ver.vals))
+		for c, cv := range ver.vals {
+			cols[string(c)] = string(cv)
+		}
+		evicted = append(evicted, Evicted{Table: t.name, Cols: cols, Data: ver.data})
+	}
+
+	return evicted
+}
+
+// lru is the LRU policy: rows are kept in a list, most recently used first
+type lru struct {
+	order *list.List
+	elems map[uint64]*list.Element
+}
+
+func newLRU() *lru {
+	return &lru{order: list.New(), elems: make(map[uint64]*list.Element)}
+}
+
+func (l *lru) Add(key uint64) {
+	l.Access(key)
+}
+
+func (l *lru) Access(key uint64) {
+	if e, found := l.elems[key]; found {
+		l.order.MoveToFront(e)
+		return
+	}
+	l.elems[key] = l.order.PushFront(key)
+}
+
+func (l *lru) Remove(key uint64) {
+	if e, found := l.elems[key]; found {
+		l.order.Remove(e)
+		delete(l.elems, key)
+	}
+}
+
+func (l *lru) Victim(skip func(key uint64) bool) (uint64, bool) {
+	for e := l.order.Back(); e != nil; e = e.Prev() {
+		if key := e.Value.(uint64); !skip(key) {
+			return key, true
+		}
+	}
+	return 0, false
+}
+
+// lfu is the LFU policy: rows are kept in a heap ordered by how often they were used, then by when they were last
+// used
+type lfu struct {
+	entries lfuHeap
+	elems   map[uint64]*lfuEntry
+	// tick orders uses, breaking ties between rows used as often
+	tick uint64
+}
+
+type lfuEntry struct {
+	key   uint64
+	uses  uint64
+	last  uint64
+	index int
+}
+
+func newLFU() *lfu {
+	return &lfu{elems: make(map[uint64]*lfuEntry)}
+}
+
+func (l *lfu) Add(key uint64) {
+	l.Access(key)
+}
+
+func (l *lfu) Access(key uint64) {
+	l.tick++
+	if e, found := l.elems[key]; found {
+		e.uses++
+		e.last = l.tick
+		heap.Fix(&l.entries, e.index)
+		return
+	}
+
+	e := &lfuEntry{key: key, uses: 1, last: l.tick}
+	l.elems[key] = e
+	heap.Push(&l.entries, e)
+}
+
+func (l *lfu) Remove(key uint64) {
+	if e, found := l.elems[key]; found {
+		heap.Remove(&l.entries, e.index)
+		delete(l.elems, key)
+	}
+}
+
+func (l *lfu) Victim(skip func(key uint64) bool) (uint64, bool) {
+	var skipped []*lfuEntry
+	defer func() {
+		for _, e := range skipped {
+			heap.Push(&l.entries, e)
+		}
+	}()
+
+	for l.entries.Len() > 0 {
+		e := l.entries[0]
+		if !skip(e.key) {
+			return e.key, true
+		}
+		skipped = append(skipped, heap.Pop(&l.entries).(*lfuEntry))
+	}
+	return 0, false
+}
+
+// lfuHeap implements heap.Interface for lfu
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].uses != h[j].uses {
+		return h[i].uses < h[j].uses
+	}
+	return h[i].last < h[j].last
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
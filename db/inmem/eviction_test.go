@@ -0,0 +1,253 @@
+package inmem_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"sort"
+	"testing"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+// newestFirst is an eviction policy that evicts the newest row
+type newestFirst struct {
+	keys map[uint64]bool
+}
+
+func (p *newestFirst) Add(key uint64)    { p.keys[key] = true }
+func (p *newestFirst) Access(key uint64) { p.keys[key] = true }
+func (p *newestFirst) Remove(key uint64) { delete(p.keys, key) }
+
+func (p *newestFirst) Victim(skip func(key uint64) bool) (uint64, bool) {
+	keys := make([]uint64, 0, len(p.keys))
+	for k := range p.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] > keys[j] })
+
+	for _, k := range keys {
+		if !skip(k) {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+func init() {
+	inmem.RegisterEvictionPolicy("newest", func() inmem.Evictor {
+		return &newestFirst{keys: make(map[uint64]bool)}
+	})
+}
+
+func TestDB_Eviction(t *testing.T) {
+
+	insert := func(db *inmem.DB, table, id string) error {
+		return db.Insert(context.Background(), table, []string{"id", "csid"}, []string{id, "cs1"}, []byte(id))
+	}
+	read := func(db *inmem.DB, table, id string) error {
+		_, err := db.Get(context.Background(), table, "id", id)
+		return err
+	}
+
+	testCases := []struct {
+		name  string
+		table inmem.Table
+		// write runs against the DB, which starts out empty
+		write       func(db *inmem.DB) error
+		want        [][]byte
+		wantEvicted []inmem.Evicted
+	}{
+		{
+			name:  "should evict the least recently used row",
+			table: inmem.Table{Name: "cache", Columns: []string{"csid"}, Unique: []string{"id"}, MaxRows: 2},
+			write: func(db *inmem.DB) error {
+				for _, err := range []error{
+					insert(db, "cache", "row1"),
+					insert(db, "cache", "row2"),
+					read(db, "cache", "row1"),
+					insert(db, "cache", "row3"),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: [][]byte{[]byte("row1"), []byte("row3")},
+			wantEvicted: []inmem.Evicted{
+				{Table: "cache", Cols: map[string]string{"id": "row2", "csid": "cs1"}, Data: []byte("row2")},
+			},
+		},
+		{
+			name:  "should evict the least frequently used row",
+			table: inmem.Table{Name: "cache", Columns: []string{"csid"}, Unique: []string{"id"}, MaxRows: 2, Eviction: inmem.LFU},
+			write: func(db *inmem.DB) error {
+				for _, err := range []error{
+					insert(db, "cache", "row1"),
+					read(db, "cache", "row1"),
+					read(db, "cache", "row1"),
+					insert(db, "cache", "row2"),
+					read(db, "cache", "row2"),
+					insert(db, "cache", "row3"),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: [][]byte{[]byte("row1"), []byte("row3")},
+			wantEvicted: []inmem.Evicted{
+				{Table: "cache", Cols: map[string]string{"id": "row2", "csid": "cs1"}, Data: []byte("row2")},
+			},
+		},
+		{
+			name: "should evict rows to stay within the byte limit",
+			// each row takes 16 bytes: 4 of data, 2 and 4 for id and its value, 4 and 3 for csid and its value
+			table: inmem.Table{Name: "cache", Columns: []string{"csid"}, Unique: []string{"id"}, MaxBytes: 40},
+			write: func(db *inmem.DB) error {
+				for _, id := range []string{"row1", "row2", "row3", "row4"} {
+					if err := insert(db, "cache", id); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: [][]byte{[]byte("row3"), []byte("row4")},
+			wantEvicted: []inmem.Evicted{
+				{Table: "cache", Cols: map[string]string{"id": "row1", "csid": "cs1"}, Data: []byte("row1")},
+				{Table: "cache", Cols: map[string]string{"id": "row2", "csid": "cs1"}, Data: []byte("row2")},
+			},
+		},
+		{
+			name:  "should not evict rows written by the same commit",
+			table: inmem.Table{Name: "cache", Columns: []string{"csid"}, Unique: []string{"id"}, MaxRows: 1},
+			write: func(db *inmem.DB) error {
+				if err := insert(db, "cache", "row1"); err != nil {
+					return err
+				}
+
+				tx, err := db.Begin(context.Background())
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+
+				for _, id := range []string{"row2", "row3"} {
+					if err := tx.Insert(context.Background(), "cache", []string{"id", "csid"}, []string{id, "cs1"}, []byte(id)); err != nil {
+						return err
+					}
+				}
+				return tx.Commit()
+			},
+			want: [][]byte{[]byte("row2"), []byte("row3")},
+			wantEvicted: []inmem.Evicted{
+				{Table: "cache", Cols: map[string]string{"id": "row1", "csid": "cs1"}, Data: []byte("row1")},
+			},
+		},
+		{
+			name:  "should evict with a registered policy",
+			table: inmem.Table{Name: "cache", Columns: []string{"csid"}, Unique: []string{"id"}, MaxRows: 2, Eviction: "newest"},
+			write: func(db *inmem.DB) error {
+				for _, id := range []string{"row1", "row2", "row3"} {
+					if err := insert(db, "cache", id); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: [][]byte{[]byte("row1"), []byte("row3")},
+			wantEvicted: []inmem.Evicted{
+				{Table: "cache", Cols: map[string]string{"id": "row2", "csid": "cs1"}, Data: []byte("row2")},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			var evicted []inmem.Evicted
+			db := inmem.NewDB([]inmem.Table{tc.table}, inmem.WithOnEvict(func(e inmem.Evicted) {
+				evicted = append(evicted, e)
+			}))
+
+			if !assert.Nil(t, tc.write(db)) {
+				return
+			}
+
+			got, err := db.Get(context.Background(), tc.table.Name, "csid", "cs1")
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantEvicted, evicted)
+
+			// evicted rows are gone from every index, so their unique values are free again
+			for _, e := range evicted {
+				got, err := db.Get(context.Background(), tc.table.Name, "id", e.Cols["id"])
+				assert.Nil(t, err)
+				assert.Equal(t, [][]byte{}, got)
+			}
+		})
+	}
+}
+
+func TestDB_EvictionSchema(t *testing.T) {
+
+	t.Run("should reject an unknown eviction policy", func(t *testing.T) {
+		db := inmem.NewDB(nil)
+		err := db.CreateTable(context.Background(), inmem.Table{Name: "cache", MaxRows: 1, Eviction: "mru"})
+		assert.Equal(t, &inmem.Error{Err: inmem.ErrUnknownEviction, Table: "cache", Value: "mru"}, err)
+	})
+
+	t.Run("should panic on an unknown eviction policy in NewDB", func(t *testing.T) {
+		want := &inmem.Error{Err: inmem.ErrUnknownEviction, Table: "cache", Value: "mru"}
+		assert.PanicsWithError(t, want.Error(), func() {
+			inmem.NewDB([]inmem.Table{{Name: "cache", MaxRows: 1, Eviction: "mru"}})
+		})
+	})
+
+	t.Run("should reject a snapshot with an unknown eviction policy", func(t *testing.T) {
+		var buf bytes.Buffer
+		db := inmem.NewDB([]inmem.Table{{Name: "cache", MaxRows: 1, Eviction: inmem.LFU}})
+		if !assert.Nil(t, db.SaveSnapshot(&buf)) {
+			return
+		}
+
+		// swap the policy for one that isn't registered, fixing up the checksum after it
+		b := buf.Bytes()
+		body := bytes.Replace(b[:len(b)-4], []byte(inmem.LFU), []byte("mru"), 1)
+		b = make([]byte, len(body)+4)
+		copy(b, body)
+		binary.BigEndian.PutUint32(b[len(body):], crc32.ChecksumIEEE(body))
+
+		_, err := inmem.LoadSnapshot(bytes.NewReader(b))
+		assert.Equal(t, &inmem.Error{Err: inmem.ErrUnknownEviction, Table: "cache", Value: "mru"}, err)
+	})
+
+	t.Run("should keep limits across a restart", func(t *testing.T) {
+		dir := t.TempDir()
+		tables := []inmem.Table{{Name: "cache", Columns: []string{"csid"}, MaxRows: 1, Eviction: inmem.LFU}}
+
+		db, err := inmem.Open(dir, tables)
+		if !assert.Nil(t, err) {
+			return
+		}
+		ctx := context.Background()
+		if !assert.Nil(t, db.Insert(ctx, "cache", []string{"csid"}, []string{"cs1"}, []byte("row1"))) ||
+			!assert.Nil(t, db.Close()) {
+			return
+		}
+
+		db, err = inmem.Open(dir, tables)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer db.Close()
+
+		assert.Nil(t, db.Insert(ctx, "cache", []string{"csid"}, []string{"cs1"}, []byte("row2")))
+		got, err := db.Get(ctx, "cache", "csid", "cs1")
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("row2")}, got)
+	})
+}
@@ -0,0 +1,231 @@
+package inmem
+
+import (
+	"context"
+	"sort"
+)
+
+// Row is a row as passed to hooks and Scan callbacks: its indexed values, as Cols and Vals sorted by column, and its data
+type Row struct {
+	Table string
+	Cols  []string
+	Vals  []string
+	Data  []byte
+}
+
+// Hooks are run on every row written to a table, inside the statement writing it. Each is optional
+//
+// Before hooks run before the row is written and can veto the write by returning an error, which the statement
+// returns. BeforeInsert and BeforeUpdate are passed the new row and can change it, for example to stamp audit fields;
+// the changed row is checked against the table's strict and unique columns like any other write
+//
+// After hooks run once the row is written, still inside the transaction, so they can make further writes, or check
+// invariants and veto the whole transaction by returning an error. The statement returns the error and the Tx can no
+// longer commit: Commit returns the error too, applying nothing
+//
+// Hooks are passed the transaction writing the row, so their own reads and writes are part of it. They run without
+// the written table locked, so they can use any table, including the same one. Rows deleted by eviction or removed by
+// expiry don't run hooks. On a DB with hooks, DB write methods run as transactions like Begin's rather than hold the
+// table's lock throughout, and are retried, hooks and all, if their commit conflicts
+type Hooks struct {
+	BeforeInsert func(ctx context.Context, tx *Tx, row *Row) error
+	AfterInsert  func(ctx context.Context, tx *Tx, row Row) error
+	BeforeUpdate func(ctx context.Context, tx *Tx, old Row, row *Row) error
+	AfterUpdate  func(ctx context.Context, tx *Tx, old Row, row Row) error
+	BeforeDelete func(ctx context.Context, tx *Tx, old Row) error
+	AfterDelete  func(ctx context.Context, tx *Tx, old Row) error
+}
+
+// WithHooks runs hooks on every write to table. Hooks added for the same table run in the order they were added
+func WithHooks(table string, hooks Hooks) Option {
+	return func(db *DB) {
+		if db.hooks == nil {
+			db.hooks = make(map[string][]Hooks)
+		}
+		db.hooks[table] = append(db.hooks[table], hooks)
+	}
+}
+
+// newRow returns ver as a Row of table
+func newRow(table string, ver *version) Row {
+	cols := make([]string, 0, len(ver.vals))
+	for c := range ver.vals {
+		cols = append(cols, string(c))
+	}
+	sort.Strings(cols)
+
+	vals := make([]string, len(cols))
+	for i, c := range cols {
+		vals[i] = string(ver.vals[colName(c)])
+	}
+
+	return Row{Table: table, Cols: cols, Vals: vals, Data: ver.data}
+}
+
+// put records rows as written by the transaction, like write, running the table's hooks around it. Before hooks may
+// change the rows, so they are checked again before they are written
+func (v *view) put(ctx context.Context, cols []string, rows map[rowID]*version) error {
+	var hooks []Hooks
+	if v.tx != nil {
+		hooks = v.tx.db.hooks[v.t.name]
+	}
+	if len(hooks) == 0 {
+		v.write(cols, rows)
+		return nil
+	}
+
+	rowIDs := sortedRowIDs(rows)
+	olds := make(map[rowID]*version, len(rows))
+	for _, rid := range rowIDs {
+		olds[rid], _ = v.lookup(rid)
+	}
+
+	changed := false
+	if err := v.unlocked(ctx, func() error {
+		for _, rid := range rowIDs {
+			ver, err := v.before(ctx, hooks, olds[rid], rows[rid])
+			if err != nil {
+				return err
+			}
+			if ver != rows[rid] {
+				rows[rid] = ver
+				changed = true
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if changed {
+		for _, ver := range rows {
+			if ver == nil {
+				continue
+			}
+			for c := range ver.vals {
+				cols = append(cols, string(c))
+			}
+		}
+		if err := v.t.checkColumns(cols); err != nil {
+			return err
+		}
+		if err := v.checkUnique(ctx, rows); err != nil {
+			return err
+		}
+	}
+
+	v.write(cols, rows)
+
+	err := v.unlocked(ctx, func() error {
+		for _, rid := range rowIDs {
+			if err := v.after(ctx, hooks, olds[rid], rows[rid]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && v.tx.failed == nil {
+		// the rows are already written, so the transaction mustn't commit them
+		v.tx.failed = err
+	}
+	return err
+}
+
+// unlocked runs fn with the statement's write lock on the table let go of, taking it back once fn is done, so hooks can
+// lock any table without taking locks out of order. The transaction's writes are its own and the versions it read stay
+// put meanwhile; anything another transaction commits to the same rows is caught when it commits
+func (v *view) unlocked(ctx context.Context, fn func() error) error {
+	if !v.wlocked {
+		return fn()
+	}
+
+	v.wlocked = false
+	v.t.mu.unlock()
+	if err := fn(); err != nil {
+		return err
+	}
+
+	if err := v.t.mu.lock(ctx); err != nil {
+		return err
+	}
+	v.wlocked = true
+
+	if v.t.dropped {
+		return &Error{Err: ErrTableNotFound, Table: v.t.name}
+	}
+	return nil
+}
+
+// before runs the before hooks for writing ver over old, returning the version to write: ver itself unless a hook
+// changed the row
+func (v *view) before(ctx context.Context, hooks []Hooks, old, ver *version) (*version, error) {
+	if ver == nil {
+		if old == nil {
+			return nil, nil
+		}
+		for _, h := range hooks {
+			if h.BeforeDelete != nil {
+				if err := h.BeforeDelete(ctx, v.tx, newRow(v.t.name, old)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	}
+
+	var oldRow Row
+	if old != nil {
+		oldRow = newRow(v.t.name, old)
+	}
+
+	row := newRow(v.t.name, ver)
+	ran := false
+	for _, h := range hooks {
+		var err error
+		switch {
+		case old == nil && h.BeforeInsert != nil:
+			err, ran = h.BeforeInsert(ctx, v.tx, &row), true
+		case old != nil && h.BeforeUpdate != nil:
+			err, ran = h.BeforeUpdate(ctx, v.tx, oldRow, &row), true
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !ran {
+		return ver, nil
+	}
+	if len(row.Cols) != len(row.Vals) {
+		return nil, &Error{Err: ErrArityMismatch, Table: v.t.name}
+	}
+
+	// the hooks may have changed anything, so the version is rebuilt from the row
+	return row.version(ver), nil
+}
+
+// after runs the after hooks for ver having been written over old
+func (v *view) after(ctx context.Context, hooks []Hooks, old, ver *version) error {
+	for _, h := range hooks {
+		var err error
+		switch {
+		case old == nil && ver == nil:
+		case ver == nil && h.AfterDelete != nil:
+			err = h.AfterDelete(ctx, v.tx, newRow(v.t.name, old))
+		case old == nil && h.AfterInsert != nil:
+			err = h.AfterInsert(ctx, v.tx, newRow(v.t.name, ver))
+		case old != nil && ver != nil && h.AfterUpdate != nil:
+			err = h.AfterUpdate(ctx, v.tx, newRow(v.t.name, old), newRow(v.t.name, ver))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// version returns the version r makes of ver, keeping ver's expiry
+func (r *Row) version(ver *version) *version {
+	return row{cols: r.Cols, vals: r.Vals, data: r.Data, expires: ver.expires}.version()
+}
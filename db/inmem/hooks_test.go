@@ -0,0 +1,377 @@
+package inmem_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+var errUnknownUser = errors.New("unknown user")
+
+// val returns the value r holds for col
+func val(r inmem.Row, col string) string {
+	for i, c := range r.Cols {
+		if c == col {
+			return r.Vals[i]
+		}
+	}
+	return ""
+}
+
+func TestDB_Hooks(t *testing.T) {
+
+	ctx := context.Background()
+
+	// importHooks stamp every import with the user who made it, who must have a profile, and record each write to
+	// an import in the audit table
+	importHooks := inmem.Hooks{
+		BeforeInsert: func(ctx context.Context, tx *inmem.Tx, row *inmem.Row) error {
+			if _, err := tx.GetByKey(ctx, "profiles", val(*row, "userid")); err != nil {
+				return errUnknownUser
+			}
+			row.Cols = append(row.Cols, "status")
+			row.Vals = append(row.Vals, "new")
+			return nil
+		},
+		BeforeUpdate: func(ctx context.Context, tx *inmem.Tx, old inmem.Row, row *inmem.Row) error {
+			row.Data = append(append([]byte{}, row.Data...), []byte("-v2")...)
+			return nil
+		},
+		AfterInsert: func(ctx context.Context, tx *inmem.Tx, row inmem.Row) error {
+			return tx.Insert(ctx, "audit", []string{"importid"}, []string{val(row, "id")}, []byte("insert "+string(row.Data)))
+		},
+		AfterUpdate: func(ctx context.Context, tx *inmem.Tx, old, row inmem.Row) error {
+			return tx.Insert(ctx, "audit", []string{"importid"}, []string{val(row, "id")}, []byte("update "+string(old.Data)+" to "+string(row.Data)))
+		},
+		BeforeDelete: func(ctx context.Context, tx *inmem.Tx, old inmem.Row) error {
+			if val(old, "status") == "locked" {
+				return inmem.ErrConflict
+			}
+			return nil
+		},
+		AfterDelete: func(ctx context.Context, tx *inmem.Tx, old inmem.Row) error {
+			return tx.Insert(ctx, "audit", []string{"importid"}, []string{val(old, "id")}, []byte("delete "+string(old.Data)))
+		},
+	}
+
+	testCases := []struct {
+		name    string
+		write   func(db *inmem.DB) error
+		wantErr error
+		// wantRows are the imports with wantStatus, new unless set
+		wantStatus string
+		wantRows   [][]byte
+		wantAudit  [][]byte
+	}{
+		{
+			name: "should stamp inserts and record them",
+			write: func(db *inmem.DB) error {
+				return db.Insert(ctx, "imports", []string{"id", "userid"}, []string{"import1", "user1"}, []byte("import1"))
+			},
+			wantRows:  [][]byte{[]byte("import1")},
+			wantAudit: [][]byte{[]byte("insert import1")},
+		},
+		{
+			name: "should veto an insert and write nothing",
+			write: func(db *inmem.DB) error {
+				return db.Insert(ctx, "imports", []string{"id", "userid"}, []string{"import1", "user2"}, []byte("import1"))
+			},
+			wantErr:   errUnknownUser,
+			wantRows:  [][]byte{},
+			wantAudit: [][]byte{},
+		},
+		{
+			name: "should change and record updates",
+			write: func(db *inmem.DB) error {
+				if err := db.Insert(ctx, "imports", []string{"id", "userid"}, []string{"import1", "user1"}, []byte("import1")); err != nil {
+					return err
+				}
+				return db.Update(ctx, "imports", "id", "import1", []byte("import1"))
+			},
+			wantRows:  [][]byte{[]byte("import1-v2")},
+			wantAudit: [][]byte{[]byte("insert import1"), []byte("update import1 to import1-v2")},
+		},
+		{
+			name: "should record deletes",
+			write: func(db *inmem.DB) error {
+				if err := db.Insert(ctx, "imports", []string{"id", "userid"}, []string{"import1", "user1"}, []byte("import1")); err != nil {
+					return err
+				}
+				return db.Delete(ctx, "imports", "id", "import1")
+			},
+			wantRows:  [][]byte{},
+			wantAudit: [][]byte{[]byte("insert import1"), []byte("delete import1")},
+		},
+		{
+			name: "should veto a delete",
+			write: func(db *inmem.DB) error {
+				if err := db.Insert(ctx, "imports", []string{"id", "userid"}, []string{"import1", "user1"}, []byte("import1")); err != nil {
+					return err
+				}
+				if err := db.UpdateRow(ctx, "imports", "id", "import1", []string{"status"}, []string{"locked"}, []byte("import1")); err != nil {
+					return err
+				}
+				return db.Delete(ctx, "imports", "id", "import1")
+			},
+			wantErr:    inmem.ErrConflict,
+			wantStatus: "locked",
+			wantRows:   [][]byte{[]byte("import1-v2")},
+			wantAudit:  [][]byte{[]byte("insert import1"), []byte("update import1 to import1-v2")},
+		},
+		{
+			name: "should run hooks for every write in a transaction",
+			write: func(db *inmem.DB) error {
+				tx, err := db.Begin(ctx)
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+
+				for _, err := range []error{
+					tx.Insert(ctx, "profiles", []string{"id"}, []string{"user2"}, []byte("profile2")),
+					tx.Insert(ctx, "imports", []string{"id", "userid"}, []string{"import1", "user2"}, []byte("import1")),
+					tx.Insert(ctx, "imports", []string{"id", "userid"}, []string{"import2", "user1"}, []byte("import2")),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				return tx.Commit()
+			},
+			wantRows:  [][]byte{[]byte("import1"), []byte("import2")},
+			wantAudit: [][]byte{[]byte("insert import1"), []byte("insert import2")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{
+				{Name: "imports", Columns: []string{"userid", "status"}, Unique: []string{"id"}},
+				{Name: "profiles", PrimaryKey: "id"},
+				{Name: "audit", Columns: []string{"importid"}},
+			}, inmem.WithHooks("imports", importHooks))
+			if !assert.Nil(t, db.Insert(ctx, "profiles", []string{"id"}, []string{"user1"}, []byte("profile1"))) {
+				return
+			}
+
+			assert.Equal(t, tc.wantErr, tc.write(db))
+
+			status := tc.wantStatus
+			if status == "" {
+				status = "new"
+			}
+			got, err := db.Query(ctx, "imports", inmem.Eq("status", status))
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantRows, got)
+
+			audit, err := db.Query(ctx, "audit", nil)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantAudit, audit)
+		})
+	}
+}
+
+func TestDB_HooksCheckChanges(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Run("should check rows changed by a hook against unique columns", func(t *testing.T) {
+		db := inmem.NewDB(walTables, inmem.WithHooks("imports", inmem.Hooks{
+			BeforeInsert: func(ctx context.Context, tx *inmem.Tx, row *inmem.Row) error {
+				row.Vals[0] = "import1"
+				return nil
+			},
+		}))
+
+		assert.Nil(t, db.Insert(ctx, "imports", []string{"id"}, []string{"import1"}, []byte("import1")))
+		err := db.Insert(ctx, "imports", []string{"id"}, []string{"import2"}, []byte("import2"))
+		assert.Equal(t, &inmem.Error{Err: inmem.ErrUniqueViolation, Table: "imports", Column: "id", Value: "import1"}, err)
+	})
+
+	t.Run("should check rows changed by a hook against strict tables", func(t *testing.T) {
+		db := inmem.NewDB([]inmem.Table{{Name: "imports", Columns: []string{"csid"}, Strict: true}}, inmem.WithHooks("imports", inmem.Hooks{
+			BeforeInsert: func(ctx context.Context, tx *inmem.Tx, row *inmem.Row) error {
+				row.Cols = append(row.Cols, "createdby")
+				row.Vals = append(row.Vals, "user1")
+				return nil
+			},
+		}))
+
+		err := db.Insert(ctx, "imports", []string{"csid"}, []string{"cs1"}, []byte("import1"))
+		assert.Equal(t, &inmem.Error{Err: inmem.ErrColumnNotDeclared, Table: "imports", Column: "createdby"}, err)
+	})
+
+	t.Run("should let hooks use their own table in a transaction", func(t *testing.T) {
+		db := inmem.NewDB(walTables, inmem.WithHooks("imports", inmem.Hooks{
+			BeforeInsert: func(ctx context.Context, tx *inmem.Tx, row *inmem.Row) error {
+				existing, err := tx.Get(ctx, "imports", "csid", val(*row, "csid"))
+				if err == nil && len(existing) > 0 {
+					return inmem.ErrConflict
+				}
+				return err
+			},
+		}))
+
+		tx, err := db.Begin(ctx)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer tx.Rollback()
+
+		assert.Nil(t, tx.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")))
+		assert.Equal(t, inmem.ErrConflict, tx.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, []byte("import2")))
+		assert.Nil(t, tx.Commit())
+	})
+
+	t.Run("should discard a transaction's writes when an after hook fails", func(t *testing.T) {
+		db := inmem.NewDB(walTables, inmem.WithHooks("imports", inmem.Hooks{
+			AfterInsert: func(ctx context.Context, tx *inmem.Tx, row inmem.Row) error {
+				if err := tx.Insert(ctx, "profiles", []string{"id"}, []string{"user1"}, []byte("profile1")); err != nil {
+					return err
+				}
+				return errUnknownUser
+			},
+		}))
+
+		assert.Equal(t, errUnknownUser, db.Insert(ctx, "imports", []string{"id"}, []string{"import1"}, []byte("import1")))
+		for table, id := range map[string]string{"imports": "import1", "profiles": "user1"} {
+			got, err := db.Get(ctx, table, "id", id)
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{}, got)
+		}
+	})
+
+	t.Run("should not commit a transaction an after hook vetoed", func(t *testing.T) {
+		db := inmem.NewDB(walTables, inmem.WithHooks("imports", inmem.Hooks{
+			AfterInsert: func(ctx context.Context, tx *inmem.Tx, row inmem.Row) error {
+				if err := tx.Insert(ctx, "profiles", []string{"id"}, []string{"user1"}, []byte("profile1")); err != nil {
+					return err
+				}
+				return errUnknownUser
+			},
+		}))
+
+		tx, err := db.Begin(ctx)
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, errUnknownUser, tx.Insert(ctx, "imports", []string{"id"}, []string{"import1"}, []byte("import1")))
+		assert.Equal(t, errUnknownUser, tx.Commit())
+		assert.Equal(t, inmem.ErrTxDone, tx.Rollback())
+
+		for table, id := range map[string]string{"imports": "import1", "profiles": "user1"} {
+			got, err := db.Get(ctx, table, "id", id)
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{}, got)
+		}
+	})
+}
+
+func TestDB_HooksConcurrent(t *testing.T) {
+
+	const (
+		workers = 4
+		writes  = 200
+	)
+
+	// every row written to one table is mirrored to the other, so writes to a and b each lock both tables
+	mirror := func(to string) inmem.Hooks {
+		return inmem.Hooks{
+			AfterInsert: func(ctx context.Context, tx *inmem.Tx, row inmem.Row) error {
+				if val(row, "mirror") != "" {
+					return nil
+				}
+				// let the other workers run, so they write the other table meanwhile
+				time.Sleep(time.Millisecond)
+				return tx.Insert(ctx, to, []string{"id", "mirror"}, []string{val(row, "id"), "true"}, row.Data)
+			},
+			BeforeUpdate: func(ctx context.Context, tx *inmem.Tx, old inmem.Row, row *inmem.Row) error {
+				time.Sleep(time.Millisecond)
+				return nil
+			},
+		}
+	}
+	db := inmem.NewDB([]inmem.Table{{Name: "a", Columns: []string{"id"}}, {Name: "b", Columns: []string{"id"}}},
+		inmem.WithHooks("a", mirror("b")), inmem.WithHooks("b", mirror("a")))
+
+	// a deadlock shows up as calls failing with the deadline rather than the test hanging
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				id := fmt.Sprintf("%d-%d", w, i)
+				table := []string{"a", "b"}[(w+i)%2]
+
+				var err error
+				if i%3 == 0 {
+					err = insertTx(ctx, db, table, id)
+				} else {
+					err = db.Insert(ctx, table, []string{"id"}, []string{id}, []byte(id))
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for _, table := range []string{"a", "b"} {
+		n, err := db.Count(context.Background(), table, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, workers*writes, n, table)
+	}
+
+	// DB writes run as transactions once there are hooks, but still never fail with ErrConflict
+	errs = make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if err := db.Update(ctx, "a", "id", "0-0", []byte(fmt.Sprintf("%d-%d", w, i))); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// insertTx inserts a row with id into table in a transaction of its own
+func insertTx(ctx context.Context, db *inmem.DB, table, id string) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := tx.Insert(ctx, table, []string{"id"}, []string{id}, []byte(id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,128 @@
+package inmem
+
+import (
+	"context"
+	"sync"
+)
+
+// rwLock is a readers-writer lock like sync.RWMutex, except that waiting for it can be abandoned when a context is
+// done. As with sync.RWMutex, once a writer is waiting new readers wait behind it, so a steady stream of readers can't
+// starve writers
+type rwLock struct {
+	mu      sync.Mutex
+	readers int
+	writer  bool
+	// writersWaiting counts the writers waiting for the lock
+	writersWaiting int
+	// released is closed, and replaced, whenever the lock is released or a waiting writer gives up, waking every
+	// waiter to try again
+	released chan struct{}
+}
+
+// lock acquires the lock for writing, returning ctx.Err() if ctx is done before it can
+func (l *rwLock) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	waiting := false
+	for l.writer || l.readers > 0 {
+		if !waiting {
+			waiting = true
+			l.writersWaiting++
+		}
+
+		released := l.wait()
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.writersWaiting--
+			// readers held back by this writer may go ahead now
+			l.wake()
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+
+		l.mu.Lock()
+	}
+
+	if waiting {
+		l.writersWaiting--
+	}
+	l.writer = true
+	l.mu.Unlock()
+
+	return nil
+}
+
+// rlock acquires the lock for reading, returning ctx.Err() if ctx is done before it can
+func (l *rwLock) rlock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	for l.writer || l.writersWaiting > 0 {
+		released := l.wait()
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		l.mu.Lock()
+	}
+
+	l.readers++
+	l.mu.Unlock()
+
+	return nil
+}
+
+// unlock releases the lock held for writing
+func (l *rwLock) unlock() {
+	l.mu.Lock()
+	l.writer = false
+	l.wake()
+	l.mu.Unlock()
+}
+
+// runlock releases the lock held for reading
+func (l *rwLock) runlock() {
+	l.mu.Lock()
+	l.readers--
+	if l.readers == 0 {
+		l.wake()
+	}
+	l.mu.Unlock()
+}
+
+// contended reports whether a writer is waiting for the lock
+func (l *rwLock) contended() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.writersWaiting > 0
+}
+
+// wait returns the channel closed on the next release. l.mu must be held
+func (l *rwLock) wait() chan struct{} {
+	if l.released == nil {
+		l.released = make(chan struct{})
+	}
+	return l.released
+}
+
+// wake wakes every waiter. l.mu must be held
+func (l *rwLock) wake() {
+	if l.released != nil {
+		close(l.released)
+		l.released = nil
+	}
+}
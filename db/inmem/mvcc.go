@@ -0,0 +1,284 @@
+package inmem
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// record is a stored row: its versions, newest first
+type record struct {
+	versions *version
+}
+
+// version is one state of a row, written by the commit with timestamp ts. Versions are never changed once committed,
+// other than dropping older versions off the end of the chain when they are garbage collected. A version with an
+// expiry isn't visible to any snapshot once the DB's clock reaches it
+type version struct {
+	ts      uint64
+	vals    map[colName]val
+	data    []byte
+	expires time.Time
+	deleted bool
+	prev    *version
+}
+
+// expired reports whether the version has expired as of now
+func (ver *version) expired(now time.Time) bool {
+	return !ver.expires.IsZero() && !now.Before(ver.expires)
+}
+
+// at returns the version of the row visible at snapshot ts, or nil if the row didn't exist or was deleted at ts
+func (r *record) at(ts uint64) *version {
+	ver := r.versions
+	for ver != nil && ver.ts > ts {
+		ver = ver.prev
+	}
+
+	if ver == nil || ver.deleted {
+		return nil
+	}
+	return ver
+}
+
+// visible returns the version of row rid visible at snapshot ts
+func (t *table) visible(rid rowID, ts uint64) *version {
+	rec, found := t.rowData[rid]
+	if !found {
+		return nil
+	}
+	return rec.at(ts)
+}
+
+// install adds ver as the newest version of row rid, stamped with commit timestamp ts. A nil ver deletes the row
+func (t *table) install(rid rowID, ver *version, ts uint64) {
+	if ver == nil {
+		ver = &version{deleted: true}
+	}
+
+	t.track(rid, t.latest(rid), ver)
+	rec, found := t.rowData[rid]
+	if !found {
+		rec = &record{}
+		t.rowData[rid] = rec
+	}
+
+	ver.ts = ts
+	ver.prev = rec.versions
+	rec.versions = ver
+	if ver.prev != nil {
+		t.garbage = append(t.garbage, superseded{rid: rid, ts: ts})
+	}
+	if ver.expires.IsZero() {
+		delete(t.expiring, rid)
+	} else {
+		t.expiring[rid] = true
+	}
+
+	for c, v := range ver.vals {
+		t.index(c, v, rid)
+	}
+}
+
+// track keeps the table's size and eviction order up to date as row rid's newest version goes from old to ver. Either
+// may be nil or a delete
+func (t *table) track(rid rowID, old, ver *version) {
+	if old != nil {
+		t.liveRows--
+		t.liveBytes -= old.size()
+	}
+	if ver != nil && !ver.deleted {
+		t.liveRows++
+		t.liveBytes += ver.size()
+	}
+
+	if t.evict == nil {
+		return
+	}
+	switch {
+	case ver == nil || ver.deleted:
+		t.evict.remove(rid)
+	case old == nil:
+		t.evict.add(rid)
+	default:
+		t.evict.access(rid)
+	}
+}
+
+// superseded records that row rid was given a new version at ts, making its older versions collectable once no
+// snapshot before ts is open
+type superseded struct {
+	rid rowID
+	ts  uint64
+}
+
+// collect drops every version no snapshot at or after horizon can see. Rows deleted at or before horizon are removed
+// from rowData and every index, and values only held by dropped versions are removed from the indexes. Only rows
+// superseded at or before horizon are visited, each once
+func (t *table) collect(horizon uint64) {
+	i := 0
+	for ; i < len(t.garbage) && t.garbage[i].ts <= horizon; i++ {
+		t.collectRow(t.garbage[i].rid, horizon)
+	}
+	t.garbage = t.garbage[i:]
+}
+
+// collectRow drops the versions of row rid no snapshot at or after horizon can see
+func (t *table) collectRow(rid rowID, horizon uint64) {
+	rec, found := t.rowData[rid]
+	if !found {
+		// deleted and collected, or swept, already
+		return
+	}
+
+	keep := rec.versions
+	for keep != nil && keep.ts > horizon {
+		keep = keep.prev
+	}
+
+	if keep == nil {
+		// every version is newer than the oldest snapshot, so they are all still needed
+		return
+	}
+
+	if keep.deleted {
+		// only a row's newest version can be a delete, so every open snapshot sees the row as gone
+		for ver := rec.versions; ver != nil; ver = ver.prev {
+			for c, v := range ver.vals {
+				t.unindex(c, v, rid)
+			}
+		}
+		delete(t.rowData, rid)
+		delete(t.expiring, rid)
+		return
+	}
+
+	dropped := keep.prev
+	keep.prev = nil
+	for ver := dropped; ver != nil; ver = ver.prev {
+		for c, v := range ver.vals {
+			if !rec.holds(c, v) {
+				t.unindex(c, v, rid)
+			}
+		}
+	}
+}
+
+// holds reports whether any version of the row has v in column c
+func (r *record) holds(c colName, v val) bool {
+	for ver := r.versions; ver != nil; ver = ver.prev {
+		if cv, found := ver.vals[c]; found && cv == v {
+			return true
+		}
+	}
+	return false
+}
+
+// issue hands out the next commit timestamp. The commit must install its versions and then publish the timestamp
+func (db *DB) issue() uint64 {
+	db.commitMu.Lock()
+	defer db.commitMu.Unlock()
+
+	db.issued++
+	return db.issued
+}
+
+// publish advances the clock to ts, making the versions stamped with it visible to new snapshots. Timestamps are
+// published in the order they were issued, so publish waits for every earlier commit to publish first. Commits only
+// take a timestamp once they hold the locks of every table they write, so the commits being waited on never need a
+// lock held by this one
+func (db *DB) publish(ts uint64) {
+	db.commitMu.Lock()
+	defer db.commitMu.Unlock()
+
+	for atomic.LoadUint64(&db.clock) != ts-1 {
+		db.committed.Wait()
+	}
+
+	atomic.StoreUint64(&db.clock, ts)
+	db.committed.Broadcast()
+}
+
+// waitPublished waits until the clock reaches ts
+func (db *DB) waitPublished(ts uint64) {
+	db.commitMu.Lock()
+	defer db.commitMu.Unlock()
+
+	for atomic.LoadUint64(&db.clock) < ts {
+		db.committed.Wait()
+	}
+}
+
+// snapshot opens a snapshot at the latest commit. Versions it can see are kept until it is released
+func (db *DB) snapshot() uint64 {
+	db.snapMu.Lock()
+	defer db.snapMu.Unlock()
+
+	ts := atomic.LoadUint64(&db.clock)
+	db.snapshots[ts]++
+
+	return ts
+}
+
+// hold registers ts as an open snapshot, for a read that took it while holding a table's lock and is about to let go.
+// Close it with release
+func (db *DB) hold(ts uint64) {
+	db.snapMu.Lock()
+	defer db.snapMu.Unlock()
+
+	db.snapshots[ts]++
+}
+
+// release closes a snapshot opened with snapshot. It reports whether the horizon moved forward, meaning there may be
+// versions to collect
+func (db *DB) release(ts uint64) bool {
+	db.snapMu.Lock()
+	defer db.snapMu.Unlock()
+
+	db.snapshots[ts]--
+	if db.snapshots[ts] > 0 {
+		return false
+	}
+	delete(db.snapshots, ts)
+
+	for open := range db.snapshots {
+		if open < ts {
+			return false
+		}
+	}
+	return true
+}
+
+// horizon returns the oldest timestamp any open snapshot can read at. Versions superseded at or before the horizon
+// can't be seen by anyone
+func (db *DB) horizon() uint64 {
+	db.snapMu.Lock()
+	defer db.snapMu.Unlock()
+
+	h := atomic.LoadUint64(&db.clock)
+	for open := range db.snapshots {
+		if open < h {
+			h = open
+		}
+	}
+
+	return h
+}
+
+// collect garbage collects every table, locking each in turn. The caller must not hold any table's lock
+func (db *DB) collect() {
+	db.mu.RLock()
+	tables := make([]*table, 0, len(db.tables))
+	for _, t := range db.tables {
+		tables = append(tables, t)
+	}
+	db.mu.RUnlock()
+
+	for _, t := range tables {
+		// a background context is never done, so this waits for the lock like any other writer. The horizon is only
+		// read once the table is locked, as a read of it may register its snapshot as it lets go of the lock
+		_ = t.mu.lock(context.Background())
+		t.collect(db.horizon())
+		t.mu.unlock()
+	}
+}
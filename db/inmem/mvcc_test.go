@@ -0,0 +1,349 @@
+package inmem_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTx_Snapshot(t *testing.T) {
+
+	testCases := []struct {
+		name string
+		// concurrent runs against the DB after the transaction begins
+		concurrent func(db *inmem.DB)
+		read       func(r reader) ([][]byte, error)
+		wantTx     [][]byte
+		wantDB     [][]byte
+	}{
+		{
+			name: "should not see rows inserted after it began",
+			concurrent: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"id", "status"}, []string{"import3", "failed"}, []byte("import3"))
+			},
+			read:   getRows("imports", "status", "failed"),
+			wantTx: [][]byte{[]byte("import1")},
+			wantDB: [][]byte{[]byte("import1"), []byte("import3")},
+		},
+		{
+			name: "should still see rows deleted after it began",
+			concurrent: func(db *inmem.DB) {
+				db.Delete(context.Background(), "imports", "id", "import1")
+			},
+			read:   getRows("imports", "status", "failed"),
+			wantTx: [][]byte{[]byte("import1")},
+			wantDB: [][]byte{},
+		},
+		{
+			name: "should see rows by their values when it began",
+			concurrent: func(db *inmem.DB) {
+				db.UpdateRow(context.Background(), "imports", "id", "import2", []string{"status"}, []string{"failed"}, []byte("import2-failed"))
+				db.UpdateRow(context.Background(), "imports", "id", "import1", []string{"status"}, []string{"succeeded"}, []byte("import1-retried"))
+			},
+			read: func(r reader) ([][]byte, error) {
+				return r.Query(context.Background(), "imports", inmem.Not(inmem.Eq("status", "succeeded")))
+			},
+			wantTx: [][]byte{[]byte("import1")},
+			wantDB: [][]byte{[]byte("import2-failed")},
+		},
+		{
+			name: "should see the same data through several updates",
+			concurrent: func(db *inmem.DB) {
+				db.Update(context.Background(), "imports", "id", "import2", []byte("import2-v2"))
+				db.Update(context.Background(), "imports", "id", "import2", []byte("import2-v3"))
+			},
+			read: func(r reader) ([][]byte, error) {
+				d, err := r.GetByKey(context.Background(), "imports", "import2")
+				return [][]byte{d}, err
+			},
+			wantTx: [][]byte{[]byte("import2")},
+			wantDB: [][]byte{[]byte("import2-v3")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{
+				{
+					Name:       "imports",
+					Columns:    []string{"status"},
+					PrimaryKey: "id",
+				},
+			})
+			db.Insert(context.Background(), "imports", []string{"id", "status"}, []string{"import1", "failed"}, []byte("import1"))
+			db.Insert(context.Background(), "imports", []string{"id", "status"}, []string{"import2", "succeeded"}, []byte("import2"))
+
+			tx, err := db.Begin(context.Background())
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			tc.concurrent(db)
+
+			gotTx, err := tc.read(tx)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.wantTx, gotTx)
+
+			gotDB, err := tc.read(db)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.wantDB, gotDB)
+
+			assert.Nil(t, tx.Rollback())
+
+			// once the snapshot is gone its old versions are collected and the DB must read the same
+			gotDB, err = tc.read(db)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.wantDB, gotDB)
+		})
+	}
+}
+
+func TestTx_SnapshotConsistency(t *testing.T) {
+
+	const (
+		accounts  = 10
+		balance   = 100
+		transfers = 200
+		workers   = 4
+	)
+
+	db := inmem.NewDB([]inmem.Table{
+		{
+			Name:       "accounts",
+			PrimaryKey: "id",
+		},
+	})
+
+	for i := 0; i < accounts; i++ {
+		db.Insert(context.Background(), "accounts", []string{"id"}, []string{strconv.Itoa(i)}, []byte(strconv.Itoa(balance)))
+	}
+
+	transfer := func(from, to int) error {
+		tx, err := db.Begin(context.Background())
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, move := range []struct{ id, amount int }{{from, -1}, {to, 1}} {
+			d, err := tx.GetByKey(context.Background(), "accounts", strconv.Itoa(move.id))
+			if err != nil {
+				return err
+			}
+
+			b, err := strconv.Atoi(string(d))
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Update(context.Background(), "accounts", "id", strconv.Itoa(move.id), []byte(strconv.Itoa(b+move.amount))); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	}
+
+	total := func() (int, error) {
+		tx, err := db.Begin(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+
+		rows, err := tx.Query(context.Background(), "accounts", nil)
+		if err != nil {
+			return 0, err
+		}
+
+		sum := 0
+		for _, d := range rows {
+			b, err := strconv.Atoi(string(d))
+			if err != nil {
+				return 0, err
+			}
+			sum += b
+		}
+		return sum, nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*2)
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < transfers; i++ {
+				err := transfer((w+i)%accounts, (w+i+1)%accounts)
+				if err != nil && !errors.Is(err, inmem.ErrConflict) {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+
+		go func() {
+			defer wg.Done()
+			for i := 0; i < transfers; i++ {
+				sum, err := total()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if sum != accounts*balance {
+					errs <- errors.New("snapshot saw a partial transfer: total is " + strconv.Itoa(sum))
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	sum, err := total()
+	assert.Nil(t, err)
+	assert.Equal(t, accounts*balance, sum)
+}
+
+func TestDB_LongReads(t *testing.T) {
+
+	const rows = 20000
+
+	testCases := []struct {
+		name string
+		// read returns how many rows it saw
+		read func(ctx context.Context, db *inmem.DB) (int, error)
+	}{
+		{
+			name: "Not",
+			read: func(ctx context.Context, db *inmem.DB) (int, error) {
+				got, err := db.Query(ctx, "imports", inmem.Not(inmem.Eq("status", "failed")))
+				return len(got), err
+			},
+		},
+		{
+			name: "range",
+			read: func(ctx context.Context, db *inmem.DB) (int, error) {
+				got, err := db.Query(ctx, "imports", inmem.Gte("at", ""))
+				return len(got), err
+			},
+		},
+		{
+			name: "GroupByCount",
+			read: func(ctx context.Context, db *inmem.DB) (int, error) {
+				groups, err := db.GroupByCount(ctx, "imports", "status")
+				n := 0
+				for _, count := range groups {
+					n += count
+				}
+				return n, err
+			},
+		},
+		{
+			name: "ordered by index",
+			read: func(ctx context.Context, db *inmem.DB) (int, error) {
+				got, err := db.QueryOrdered(ctx, "imports", nil, inmem.Desc("at"))
+				return len(got), err
+			},
+		},
+		{
+			name: "sorted",
+			read: func(ctx context.Context, db *inmem.DB) (int, error) {
+				got, err := db.QueryOrdered(ctx, "imports", nil, inmem.Asc("status"), inmem.Desc("id"))
+				return len(got), err
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			// the clock is read by each statement once it has the table locked, so once armed it holds the next read
+			// there until the writer is queued behind it
+			var armed int32
+			locked, resume := make(chan struct{}), make(chan struct{})
+			now := func() time.Time {
+				if atomic.CompareAndSwapInt32(&armed, 1, 0) {
+					close(locked)
+					<-resume
+				}
+				return time.Now()
+			}
+			db := inmem.NewDB([]inmem.Table{{Name: "imports", Columns: []string{"status", "at"}, Ordered: []string{"at"}}}, inmem.WithClock(now))
+
+			tx, err := db.Begin(ctx)
+			if !assert.Nil(t, err) {
+				return
+			}
+			for i := 0; i < rows; i++ {
+				id := strconv.Itoa(i)
+				if !assert.Nil(t, tx.Insert(ctx, "imports", []string{"id", "status", "at"}, []string{id, "done", id}, []byte(id))) {
+					return
+				}
+			}
+			if !assert.Nil(t, tx.Commit()) {
+				return
+			}
+
+			atomic.StoreInt32(&armed, 1)
+			read := make(chan int, 1)
+			go func() {
+				n, err := tc.read(ctx, db)
+				assert.Nil(t, err)
+				read <- n
+			}()
+			<-locked
+
+			wrote := make(chan error, 1)
+			go func() {
+				wrote <- db.Insert(ctx, "imports", []string{"id", "status", "at"}, []string{"new", "pending", "new"}, []byte("new"))
+			}()
+
+			// reads queue behind a waiting writer, so a read that can't get the lock means the writer is waiting
+			for {
+				probeCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+				_, err := db.Count(probeCtx, "imports", inmem.Eq("status", "failed"))
+				cancel()
+				if errors.Is(err, context.DeadlineExceeded) {
+					break
+				}
+				if !assert.Nil(t, err) {
+					close(resume)
+					return
+				}
+			}
+			close(resume)
+
+			if !assert.Nil(t, <-wrote) {
+				return
+			}
+			select {
+			case <-read:
+				t.Error("the read finished before the write")
+				return
+			default:
+			}
+
+			// the write went ahead of the read, which still doesn't see it
+			assert.Equal(t, rows, <-read)
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package inmem
+
+import (
+	"context"
+	"sort"
+)
+
+// Order sorts query results by a column, compared as strings like ordered columns. Rows without a value for the column
+// sort before every row with one, ascending, and after them descending
+type Order struct {
+	Col  string
+	Desc bool
+}
+
+// Asc sorts by col, smallest first
+func Asc(col string) Order {
+	return Order{Col: col}
+}
+
+// Desc sorts by col, largest first
+func Desc(col string) Order {
+	return Order{Col: col, Desc: true}
+}
+
+// QueryOrdered returns the data of every row in table matching where, sorted by each of orderBy in turn. Rows that tie
+// on every column are returned in insertion order, as they are with no orderBy at all. A nil where matches every row.
+// When the first column is ordered, rows are read in the order of its index instead of being sorted
+// EXAMPLE:
+//
+//	latest, err := db.QueryOrdered(ctx, "imports", inmem.Eq("csid", csID), inmem.Desc("importtime"))
+func (db *DB) QueryOrdered(ctx context.Context, table string, where Predicate, orderBy ...Order) ([][]byte, error) {
+	var rows [][]byte
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		rows, err = tx.QueryOrdered(ctx, table, where, orderBy...)
+		return err
+	})
+
+	return rows, err
+}
+
+// QueryOrdered returns the data of every row in table matching where, sorted by each of orderBy in turn. See
+// DB.QueryOrdered
+func (tx *Tx) QueryOrdered(ctx context.Context, table string, where Predicate, orderBy ...Order) ([][]byte, error) {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	v, unlock, err := tx.rview(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rowIDs, err := v.eval(ctx, where)
+	if err != nil {
+		return nil, err
+	}
+
+	rowIDs, err = v.order(ctx, rowIDs, orderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.data(ctx, rowIDs)
+}
+
+// order returns rowIDs, which must all be visible to the transaction and sorted ascending, sorted by orderBy. The
+// ordered index for the first column is used if it has one, unless the transaction wrote to the table: its writes
+// aren't in the index
+func (v *view) order(ctx context.Context, rowIDs []rowID, orderBy []Order) ([]rowID, error) {
+	for _, o := range orderBy {
+		if _, err := v.column(colName(o.Col)); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(orderBy) == 0 {
+		return rowIDs, nil
+	}
+
+	if sl, found := v.t.ordered[colName(orderBy[0].Col)]; found && len(v.writes) == 0 {
+		return v.orderByIndex(ctx, sl, rowIDs, orderBy)
+	}
+
+	return rowIDs, v.sortRows(ctx, rowIDs, orderBy)
+}
+
+// orderByIndex sorts rowIDs by walking the ordered index sl of the first column of orderBy, so only rows tied on it
+// are sorted by the rest
+func (v *view) orderByIndex(ctx context.Context, sl *skiplist, rowIDs []rowID, orderBy []Order) ([]rowID, error) {
+	c := colName(orderBy[0].Col)
+
+	pending := make(map[rowID]bool, len(rowIDs))
+	for _, rid := range rowIDs {
+		pending[rid] = true
+	}
+
+	var groups [][]rowID
+	visited := 0
+	for n := sl.first(); n != nil && len(pending) > 0; {
+		pauses := v.pauses
+		var group []rowID
+		for _, rid := range v.t.rows[c][n.v] {
+			if visited%scanCheckInterval == 0 {
+				if err := v.pause(ctx); err != nil {
+					return nil, err
+				}
+			}
+			visited++
+
+			if !pending[rid] {
+				continue
+			}
+			// buckets can hold rows whose value has since changed, which are picked up under the value they hold now
+			if ver, _ := v.lookup(rid); !holds(ver, c, n.v) {
+				continue
+			}
+			group = append(group, rid)
+			delete(pending, rid)
+		}
+
+		if len(group) > 0 {
+			if err := v.sortRows(ctx, group, orderBy[1:]); err != nil {
+				return nil, err
+			}
+			groups = append(groups, group)
+		}
+		n = v.next(sl, n, pauses)
+	}
+
+	// whatever is left has no value for the column
+	if len(pending) > 0 {
+		missing := make([]rowID, 0, len(pending))
+		for rid := range pending {
+			missing = append(missing, rid)
+		}
+		if err := v.sortRows(ctx, missing, orderBy); err != nil {
+			return nil, err
+		}
+		groups = append([][]rowID{missing}, groups...)
+	}
+
+	if orderBy[0].Desc {
+		for i, j := 0, len(groups)-1; i < j; i, j = i+1, j-1 {
+			groups[i], groups[j] = groups[j], groups[i]
+		}
+	}
+
+	sorted := make([]rowID, 0, len(rowIDs))
+	for _, group := range groups {
+		sorted = append(sorted, group...)
+	}
+	return sorted, nil
+}
+
+// sortRows sorts rowIDs in place by orderBy, breaking ties by rowID. The values are read first, pausing as it goes, so
+// long lists are sorted with the read lock let go of
+func (v *view) sortRows(ctx context.Context, rowIDs []rowID, orderBy []Order) error {
+	vals := make(map[rowID]map[colName]val, len(rowIDs))
+	for i, rid := range rowIDs {
+		if i%scanCheckInterval == 0 && i > 0 {
+			if err := v.pause(ctx); err != nil {
+				return err
+			}
+		}
+
+		ver, _ := v.lookup(rid)
+		vals[rid] = ver.vals
+	}
+
+	less := func(i, j int) bool {
+		a, b := vals[rowIDs[i]], vals[rowIDs[j]]
+		for _, o := range orderBy {
+			c := colName(o.Col)
+			av, aFound := a[c]
+			bv, bFound := b[c]
+			if aFound == bFound && av == bv {
+				continue
+			}
+
+			less := !aFound || bFound && av < bv
+			if o.Desc {
+				return !less
+			}
+			return less
+		}
+		return rowIDs[i] < rowIDs[j]
+	}
+	if len(rowIDs) < scanCheckInterval {
+		sort.Slice(rowIDs, less)
+		return nil
+	}
+
+	return v.readUnlocked(ctx, func() { sort.Slice(rowIDs, less) })
+}
+
+// holds reports whether ver holds cv in column c
+func holds(ver *version, c colName, cv val) bool {
+	held, found := ver.vals[c]
+	return found && held == cv
+}
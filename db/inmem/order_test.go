@@ -0,0 +1,104 @@
+package inmem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_QueryOrdered(t *testing.T) {
+
+	ctx := context.Background()
+
+	// both tables hold the same imports; only one of them has an ordered index on importtime
+	tables := []inmem.Table{
+		{Name: "ordered", Columns: []string{"csid", "status"}, Ordered: []string{"importtime"}, Unique: []string{"id"}},
+		{Name: "unordered", Columns: []string{"csid", "status", "importtime"}, Unique: []string{"id"}},
+	}
+
+	testCases := []struct {
+		name    string
+		where   inmem.Predicate
+		orderBy []inmem.Order
+		want    [][]byte
+	}{
+		{
+			name: "should return rows in insertion order without an order",
+			want: [][]byte{[]byte("import1"), []byte("import2"), []byte("import3"), []byte("import4"), []byte("import5")},
+		},
+		{
+			name:    "should sort ascending, ties in insertion order and rows without a value first",
+			orderBy: []inmem.Order{inmem.Asc("importtime")},
+			want:    [][]byte{[]byte("import5"), []byte("import2"), []byte("import1"), []byte("import4"), []byte("import3")},
+		},
+		{
+			name:    "should sort descending, ties in insertion order and rows without a value last",
+			orderBy: []inmem.Order{inmem.Desc("importtime")},
+			want:    [][]byte{[]byte("import3"), []byte("import1"), []byte("import4"), []byte("import2"), []byte("import5")},
+		},
+		{
+			name:    "should break ties by the next column",
+			orderBy: []inmem.Order{inmem.Desc("importtime"), inmem.Desc("status")},
+			want:    [][]byte{[]byte("import3"), []byte("import4"), []byte("import1"), []byte("import2"), []byte("import5")},
+		},
+		{
+			name:    "should only sort matching rows",
+			where:   inmem.Eq("csid", "cs1"),
+			orderBy: []inmem.Order{inmem.Asc("status"), inmem.Desc("importtime")},
+			want:    [][]byte{[]byte("import1"), []byte("import5"), []byte("import3")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB(tables)
+			for _, table := range []string{"ordered", "unordered"} {
+				for _, err := range []error{
+					db.Insert(ctx, table, []string{"id", "csid", "status", "importtime"}, []string{"import1", "cs1", "done", "2021-01-02"}, []byte("import1")),
+					db.Insert(ctx, table, []string{"id", "csid", "status", "importtime"}, []string{"import2", "cs2", "done", "2021-01-01"}, []byte("import2")),
+					db.Insert(ctx, table, []string{"id", "csid", "status", "importtime"}, []string{"import3", "cs1", "pending", "2021-01-03"}, []byte("import3")),
+					db.Insert(ctx, table, []string{"id", "csid", "status", "importtime"}, []string{"import4", "cs2", "failed", "2021-01-04"}, []byte("import4")),
+					db.Insert(ctx, table, []string{"id", "csid", "status"}, []string{"import5", "cs1", "failed"}, []byte("import5")),
+					// import4 moves back, leaving its old value in the index
+					db.UpdateRow(ctx, table, "id", "import4", []string{"importtime"}, []string{"2021-01-02"}, []byte("import4")),
+				} {
+					if !assert.Nil(t, err) {
+						return
+					}
+				}
+			}
+
+			for _, table := range []string{"ordered", "unordered"} {
+				got, err := db.QueryOrdered(ctx, table, tc.where, tc.orderBy...)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, got, table)
+
+				// a transaction that wrote to the table can't use its index, but sorts the same
+				tx, err := db.Begin(ctx)
+				if !assert.Nil(t, err) {
+					return
+				}
+				if !assert.Nil(t, tx.Insert(ctx, table, []string{"id", "csid"}, []string{"import6", "cs3"}, []byte("import6"))) {
+					return
+				}
+				where := inmem.Not(inmem.Eq("csid", "cs3"))
+				if tc.where != nil {
+					where = inmem.And(tc.where, where)
+				}
+				got, err = tx.QueryOrdered(ctx, table, where, tc.orderBy...)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, got, table)
+				assert.Nil(t, tx.Rollback())
+			}
+		})
+	}
+}
+
+func TestDB_QueryOrderedErrors(t *testing.T) {
+
+	db := inmem.NewDB(walTables)
+	_, err := db.QueryOrdered(context.Background(), "imports", nil, inmem.Asc("importtime"))
+	assert.Equal(t, &inmem.Error{Err: inmem.ErrColumnNotFound, Table: "imports", Column: "importtime"}, err)
+}
@@ -0,0 +1,113 @@
+package inmem
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+)
+
+// PageOptions picks the page of rows QueryPage returns
+type PageOptions struct {
+	// Limit is the most rows the page holds. Zero or less means no limit, so the page holds every remaining row
+	Limit int
+	// Offset skips that many matching rows before the page starts, counting from the cursor if there is one
+	Offset int
+	// Cursor continues a query where the page it was returned with left off. Empty starts from the first row
+	Cursor string
+}
+
+// Page is a page of rows returned by QueryPage
+type Page struct {
+	Rows [][]byte
+	// Cursor continues the query after the last row of the page, or is empty if no rows matched past it
+	Cursor string
+}
+
+// QueryPage returns a page of the rows in table matching where, in insertion order. A nil where matches every row.
+// Pages are read by passing each page's Cursor back in PageOptions, with the same table and where
+//
+// A cursor marks a place in insertion order rather than a number of rows, so it stays valid whatever is written in
+// between: rows inserted since are returned on later pages, and rows deleted since are skipped without shifting the
+// pages after them
+// EXAMPLE:
+//
+//	opts := inmem.PageOptions{Limit: 100}
+//	for {
+//		page, err := db.QueryPage(ctx, "imports", inmem.Eq("csid", csID), opts)
+//		if err != nil {
+//			return err
+//		}
+//		send(page.Rows)
+//		if page.Cursor == "" {
+//			return nil
+//		}
+//		opts.Cursor = page.Cursor
+//	}
+func (db *DB) QueryPage(ctx context.Context, table string, where Predicate, opts PageOptions) (Page, error) {
+	var page Page
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		page, err = tx.QueryPage(ctx, table, where, opts)
+		return err
+	})
+
+	return page, err
+}
+
+// QueryPage returns a page of the rows in table matching where, in insertion order. See DB.QueryPage. Rows the
+// transaction inserted itself only get their place in insertion order when it commits, so cursors past them are only
+// valid within the transaction
+func (tx *Tx) QueryPage(ctx context.Context, table string, where Predicate, opts PageOptions) (Page, error) {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	from, err := decodeCursor(table, opts.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	v, unlock, err := tx.rview(ctx, table)
+	if err != nil {
+		return Page{}, err
+	}
+	defer unlock()
+
+	rowIDs, more, err := v.evalPage(ctx, where, from, opts.Offset, opts.Limit)
+	if err != nil {
+		return Page{}, err
+	}
+
+	rows, err := v.data(ctx, rowIDs)
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Rows: rows}
+	if more {
+		page.Cursor = encodeCursor(table, rowIDs[len(rowIDs)-1]+1)
+	}
+
+	return page, nil
+}
+
+// encodeCursor returns the cursor continuing a query on table from rowID from
+func encodeCursor(table string, from rowID) string {
+	b := make([]byte, 8, 8+len(table))
+	binary.BigEndian.PutUint64(b, uint64(from))
+	b = append(b, table...)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns the rowID cursor continues a query on table from, 0 for an empty cursor
+func decodeCursor(table, cursor string) (rowID, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) < 8 || string(b[8:]) != table {
+		return 0, &Error{Err: ErrBadCursor, Table: table, Value: cursor}
+	}
+
+	return rowID(binary.BigEndian.Uint64(b)), nil
+}
@@ -0,0 +1,164 @@
+package inmem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_QueryPage(t *testing.T) {
+
+	ctx := context.Background()
+
+	testCases := []struct {
+		name  string
+		where inmem.Predicate
+		opts  inmem.PageOptions
+		// between runs against the DB after each page
+		between func(db *inmem.DB, page int) error
+		want    [][][]byte
+	}{
+		{
+			name:  "should page through matching rows in insertion order",
+			where: inmem.Eq("csid", "cs1"),
+			opts:  inmem.PageOptions{Limit: 2},
+			want: [][][]byte{
+				{[]byte("import1"), []byte("import3")},
+				{[]byte("import5")},
+			},
+		},
+		{
+			name: "should leave the cursor off the last page",
+			opts: inmem.PageOptions{Limit: 3},
+			want: [][][]byte{
+				{[]byte("import1"), []byte("import2"), []byte("import3")},
+				{[]byte("import4"), []byte("import5")},
+			},
+		},
+		{
+			name: "should skip rows by offset",
+			opts: inmem.PageOptions{Limit: 2, Offset: 1},
+			want: [][][]byte{
+				{[]byte("import2"), []byte("import3")},
+				// the offset counts again from the cursor
+				{[]byte("import5")},
+			},
+		},
+		{
+			name: "should leave the cursor off a full page with no rows after it",
+			opts: inmem.PageOptions{Limit: 5},
+			want: [][][]byte{
+				{[]byte("import1"), []byte("import2"), []byte("import3"), []byte("import4"), []byte("import5")},
+			},
+		},
+		{
+			name: "should return every row without a limit",
+			want: [][][]byte{
+				{[]byte("import1"), []byte("import2"), []byte("import3"), []byte("import4"), []byte("import5")},
+			},
+		},
+		{
+			name: "should keep cursors valid across writes",
+			opts: inmem.PageOptions{Limit: 2},
+			between: func(db *inmem.DB, page int) error {
+				if page > 0 {
+					return nil
+				}
+				if err := db.Delete(ctx, "imports", "id", "import2"); err != nil {
+					return err
+				}
+				if err := db.Delete(ctx, "imports", "id", "import3"); err != nil {
+					return err
+				}
+				return db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import6", "cs1"}, []byte("import6"))
+			},
+			want: [][][]byte{
+				{[]byte("import1"), []byte("import2")},
+				{[]byte("import4"), []byte("import5")},
+				{[]byte("import6")},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB(walTables)
+			for i, id := range []string{"import1", "import2", "import3", "import4", "import5"} {
+				csid := "cs1"
+				if i%2 == 1 {
+					csid = "cs2"
+				}
+				if !assert.Nil(t, db.Insert(ctx, "imports", []string{"id", "csid"}, []string{id, csid}, []byte(id))) {
+					return
+				}
+			}
+
+			var got [][][]byte
+			opts := tc.opts
+			for len(got) <= len(tc.want) {
+				page, err := db.QueryPage(ctx, "imports", tc.where, opts)
+				if !assert.Nil(t, err) {
+					return
+				}
+				got = append(got, page.Rows)
+				if page.Cursor == "" {
+					break
+				}
+
+				if tc.between != nil {
+					if !assert.Nil(t, tc.between(db, len(got)-1)) {
+						return
+					}
+				}
+				opts.Cursor = page.Cursor
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB_QueryPageErrors(t *testing.T) {
+
+	ctx := context.Background()
+	db := inmem.NewDB(walTables)
+	for _, id := range []string{"user1", "user2"} {
+		if !assert.Nil(t, db.Insert(ctx, "profiles", []string{"id"}, []string{id}, []byte(id))) {
+			return
+		}
+	}
+
+	page, err := db.QueryPage(ctx, "profiles", nil, inmem.PageOptions{Limit: 1})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	testCases := []struct {
+		name    string
+		table   string
+		cursor  string
+		wantErr error
+	}{
+		{
+			name:    "should reject a cursor that wasn't returned by QueryPage",
+			table:   "profiles",
+			cursor:  "not a cursor",
+			wantErr: &inmem.Error{Err: inmem.ErrBadCursor, Table: "profiles", Value: "not a cursor"},
+		},
+		{
+			name:    "should reject a cursor for another table",
+			table:   "imports",
+			cursor:  page.Cursor,
+			wantErr: &inmem.Error{Err: inmem.ErrBadCursor, Table: "imports", Value: page.Cursor},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			_, err := db.QueryPage(ctx, tc.table, nil, inmem.PageOptions{Cursor: tc.cursor})
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
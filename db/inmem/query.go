@@ -0,0 +1,326 @@
+package inmem
+
+import (
+	"context"
+	"strings"
+)
+
+// Predicate is a condition on a table's indexed columns used to select rows in Query. Build predicates with Eq, In,
+// And, Or and Not. They are evaluated against the column indexes only; row data is never decoded
+// EXAMPLE:
+//
+//	db.Query(ctx, "imports", inmem.And(
+//		inmem.Eq("csid", csID),
+//		inmem.Not(inmem.Eq("status", "failed")),
+//	))
+type Predicate interface {
+	// eval returns the IDs of the rows in v's table that may match the predicate, sorted ascending. Every matching row
+	// is included, but so may be rows whose indexed values match in a version other than the one being read, so callers
+	// check each row with match. Long walks of the indexes pause now and then. The returned slice may be shared with
+	// the table's indexes and must not be modified
+	eval(ctx context.Context, v *view) ([]rowID, error)
+	// match reports whether a row with the indexed values vals matches the predicate
+	match(vals map[colName]val) bool
+}
+
+// Eq matches rows where col equals v
+func Eq(col string, v string) Predicate {
+	return eq{col: colName(col), v: val(v)}
+}
+
+// In matches rows where col equals any of vals
+func In(col string, vals ...string) Predicate {
+	preds := make([]Predicate, len(vals))
+	for i, v := range vals {
+		preds[i] = Eq(col, v)
+	}
+	return Or(preds...)
+}
+
+// And matches rows matching every one of preds. And with no predicates matches every row
+func And(preds ...Predicate) Predicate {
+	return and(preds)
+}
+
+// Or matches rows matching at least one of preds. Or with no predicates matches no rows
+func Or(preds ...Predicate) Predicate {
+	return or(preds)
+}
+
+// Not matches every row that doesn't match p
+func Not(p Predicate) Predicate {
+	return not{p: p}
+}
+
+// TimeLayout formats times so they sort correctly as strings, for use as values in ordered columns. Times should be
+// converted to UTC before formatting, e.g. imp.ImportTime.UTC().Format(inmem.TimeLayout)
+const TimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Gt matches rows where col is greater than v. Values are compared as strings and col must be an ordered column
+func Gt(col string, v string) Predicate {
+	lo := val(v)
+	return rng{col: colName(col), lo: &lo}
+}
+
+// Gte matches rows where col is greater than or equal to v. Values are compared as strings and col must be an ordered
+// column
+func Gte(col string, v string) Predicate {
+	lo := val(v)
+	return rng{col: colName(col), lo: &lo, loInclusive: true}
+}
+
+// Lt matches rows where col is less than v. Values are compared as strings and col must be an ordered column
+func Lt(col string, v string) Predicate {
+	hi := val(v)
+	return rng{col: colName(col), hi: &hi}
+}
+
+// Lte matches rows where col is less than or equal to v. Values are compared as strings and col must be an ordered
+// column
+func Lte(col string, v string) Predicate {
+	hi := val(v)
+	return rng{col: colName(col), hi: &hi, hiInclusive: true}
+}
+
+// Between matches rows where col is between lo and hi, inclusive. Values are compared as strings and col must be an
+// ordered column
+func Between(col string, lo string, hi string) Predicate {
+	l, h := val(lo), val(hi)
+	return rng{col: colName(col), lo: &l, loInclusive: true, hi: &h, hiInclusive: true}
+}
+
+// Prefix matches rows where col starts with prefix. col must be an ordered column
+func Prefix(col string, prefix string) Predicate {
+	lo := val(prefix)
+	return rng{col: colName(col), lo: &lo, loInclusive: true, prefix: true}
+}
+
+// Query returns the data of every row in table matching where, in insertion order. A nil where matches every row
+func (db *DB) Query(ctx context.Context, table string, where Predicate) ([][]byte, error) {
+	var rows [][]byte
+	err := db.read(ctx, func(ctx context.Context, tx *Tx) (err error) {
+		rows, err = tx.Query(ctx, table, where)
+		return err
+	})
+
+	return rows, err
+}
+
+// Query returns the data of every row in table matching where, in insertion order. A nil where matches every row
+func (tx *Tx) Query(ctx context.Context, table string, where Predicate) ([][]byte, error) {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	v, unlock, err := tx.rview(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return v.query(ctx, where)
+}
+
+type eq struct {
+	col colName
+	v   val
+}
+
+func (p eq) eval(ctx context.Context, v *view) ([]rowID, error) {
+	columnVals, err := v.t.column(p.col)
+	if err != nil {
+		return nil, err
+	}
+
+	return columnVals[p.v], nil
+}
+
+func (p eq) match(vals map[colName]val) bool {
+	v, found := vals[p.col]
+	return found && v == p.v
+}
+
+// rng matches a range of values in an ordered column. A nil lo or hi leaves that end of the range open. When prefix is
+// set the range covers every value starting with lo
+type rng struct {
+	col         colName
+	lo, hi      *val
+	loInclusive bool
+	hiInclusive bool
+	prefix      bool
+}
+
+func (p rng) eval(ctx context.Context, v *view) ([]rowID, error) {
+	t := v.t
+	if _, err := t.column(p.col); err != nil {
+		return nil, err
+	}
+
+	sl, found := t.ordered[p.col]
+	if !found {
+		return nil, &Error{Err: ErrColumnNotOrdered, Table: t.name, Column: string(p.col)}
+	}
+
+	n := sl.first()
+	if p.lo != nil {
+		n = sl.seek(*p.lo)
+		if n != nil && !p.loInclusive && n.v == *p.lo {
+			n = n.next[0]
+		}
+	}
+
+	result := make([]rowID, 0)
+	for visited := 1; n != nil && p.contains(n.v); visited++ {
+		result = append(result, t.rows[p.col][n.v]...)
+
+		pauses := v.pauses
+		if visited%scanCheckInterval == 0 {
+			if err := v.pause(ctx); err != nil {
+				return nil, err
+			}
+		}
+		n = v.next(sl, n, pauses)
+	}
+
+	return result, v.sortRowIDs(ctx, result)
+}
+
+func (p rng) match(vals map[colName]val) bool {
+	v, found := vals[p.col]
+	if !found || p.lo != nil && (v < *p.lo || !p.loInclusive && v == *p.lo) {
+		return false
+	}
+
+	return p.contains(v)
+}
+
+// contains reports whether v is in range, given that it is past lo. Values are visited in order, so the first value
+// outside the range ends the scan
+func (p rng) contains(v val) bool {
+	if p.prefix {
+		return strings.HasPrefix(string(v), string(*p.lo))
+	}
+
+	if p.hi == nil {
+		return true
+	}
+
+	if p.hiInclusive {
+		return v <= *p.hi
+	}
+	return v < *p.hi
+}
+
+type and []Predicate
+
+func (p and) eval(ctx context.Context, v *view) ([]rowID, error) {
+	if len(p) == 0 {
+		return v.rowIDs(ctx)
+	}
+
+	result, err := p[0].eval(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pred := range p[1:] {
+		rowIDs, err := pred.eval(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		result = intersect(result, rowIDs)
+	}
+
+	return result, nil
+}
+
+func (p and) match(vals map[colName]val) bool {
+	for _, pred := range p {
+		if !pred.match(vals) {
+			return false
+		}
+	}
+	return true
+}
+
+type or []Predicate
+
+func (p or) eval(ctx context.Context, v *view) ([]rowID, error) {
+	var result []rowID
+	for _, pred := range p {
+		rowIDs, err := pred.eval(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		result = union(result, rowIDs)
+	}
+
+	return result, nil
+}
+
+func (p or) match(vals map[colName]val) bool {
+	for _, pred := range p {
+		if pred.match(vals) {
+			return true
+		}
+	}
+	return false
+}
+
+type not struct {
+	p Predicate
+}
+
+func (p not) eval(ctx context.Context, v *view) ([]rowID, error) {
+	// a row in p's candidates may still not match p in the version being read, so none of them can be ruled out here
+	if _, err := p.p.eval(ctx, v); err != nil {
+		return nil, err
+	}
+
+	return v.rowIDs(ctx)
+}
+
+func (p not) match(vals map[colName]val) bool {
+	return !p.p.match(vals)
+}
+
+// intersect returns the IDs found in both a and b. Both must be sorted ascending
+func intersect(a, b []rowID) []rowID {
+	result := make([]rowID, 0)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+
+	return result
+}
+
+// union returns the IDs found in either a or b. Both must be sorted ascending
+func union(a, b []rowID) []rowID {
+	result := make([]rowID, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case a[i] > b[j]:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+
+	return append(result, b[j:]...)
+}
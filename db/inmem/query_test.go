@@ -0,0 +1,275 @@
+package inmem_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Query(t *testing.T) {
+
+	setup := func(db *inmem.DB) {
+		db.Insert(context.Background(), "imports", []string{"csid", "status", "user"}, []string{"cs1", "failed", "a"}, []byte("import1"))
+		db.Insert(context.Background(), "imports", []string{"csid", "status", "user"}, []string{"cs1", "succeeded", "b"}, []byte("import2"))
+		db.Insert(context.Background(), "imports", []string{"csid", "status", "user"}, []string{"cs2", "failed", "c"}, []byte("import3"))
+		db.Insert(context.Background(), "imports", []string{"csid", "status", "user"}, []string{"cs2", "processing", "a"}, []byte("import4"))
+	}
+
+	testCases := []struct {
+		name    string
+		table   string
+		where   inmem.Predicate
+		setup   func(db *inmem.DB)
+		want    [][]byte
+		wantErr error
+	}{
+		{
+			name:  "should match on equality",
+			table: "imports",
+			where: inmem.Eq("csid", "cs1"),
+			setup: setup,
+			want:  [][]byte{[]byte("import1"), []byte("import2")},
+		},
+		{
+			name:  "should match on AND of two columns",
+			table: "imports",
+			where: inmem.And(inmem.Eq("csid", "cs1"), inmem.Eq("status", "failed")),
+			setup: setup,
+			want:  [][]byte{[]byte("import1")},
+		},
+		{
+			name:  "should match on OR in insertion order",
+			table: "imports",
+			where: inmem.Or(inmem.Eq("status", "processing"), inmem.Eq("csid", "cs1")),
+			setup: setup,
+			want:  [][]byte{[]byte("import1"), []byte("import2"), []byte("import4")},
+		},
+		{
+			name:  "should match on IN",
+			table: "imports",
+			where: inmem.In("user", "a", "b"),
+			setup: setup,
+			want:  [][]byte{[]byte("import1"), []byte("import2"), []byte("import4")},
+		},
+		{
+			name:  "should match on NOT",
+			table: "imports",
+			where: inmem.And(inmem.Eq("csid", "cs2"), inmem.Not(inmem.Eq("status", "failed"))),
+			setup: setup,
+			want:  [][]byte{[]byte("import4")},
+		},
+		{
+			name:  "should match every row with a nil predicate",
+			table: "imports",
+			setup: setup,
+			want:  [][]byte{[]byte("import1"), []byte("import2"), []byte("import3"), []byte("import4")},
+		},
+		{
+			name:  "should match nothing with an empty OR",
+			table: "imports",
+			where: inmem.Or(),
+			setup: setup,
+			want:  [][]byte{},
+		},
+		{
+			name:  "should not match deleted rows",
+			table: "imports",
+			where: inmem.Not(inmem.Eq("status", "failed")),
+			setup: func(db *inmem.DB) {
+				setup(db)
+				db.Delete(context.Background(), "imports", "user", "b")
+			},
+			want: [][]byte{[]byte("import4")},
+		},
+		{
+			name:    "should fail due to table not existing",
+			table:   "winky wonky",
+			where:   inmem.Eq("csid", "cs1"),
+			wantErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "winky wonky"},
+		},
+		{
+			name:    "should fail due to column not existing",
+			table:   "imports",
+			where:   inmem.Or(inmem.Eq("csid", "cs1"), inmem.Eq("winky wonky", "cs1")),
+			setup:   setup,
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotFound, Table: "imports", Column: "winky wonky"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{
+				{
+					Name: "imports",
+				},
+			})
+
+			if tc.setup != nil {
+				tc.setup(db)
+			}
+
+			got, gotErr := db.Query(context.Background(), tc.table, tc.where)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, gotErr)
+				return
+			}
+
+			if !assert.Nil(t, gotErr) {
+				return
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB_QueryRange(t *testing.T) {
+
+	ts := func(s string) string {
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm.UTC().Format(inmem.TimeLayout)
+	}
+
+	setup := func(db *inmem.DB) {
+		db.Insert(context.Background(), "imports", []string{"importTime", "fileName"}, []string{ts("2021-06-01T12:00:00Z"), "a/file1"}, []byte("import1"))
+		db.Insert(context.Background(), "imports", []string{"importTime", "fileName"}, []string{ts("2021-06-03T12:00:00Z"), "a/file2"}, []byte("import2"))
+		db.Insert(context.Background(), "imports", []string{"importTime", "fileName"}, []string{ts("2021-06-02T12:00:00Z"), "b/file3"}, []byte("import3"))
+		db.Insert(context.Background(), "imports", []string{"importTime", "fileName"}, []string{ts("2021-06-04T12:00:00Z"), "ab/file4"}, []byte("import4"))
+	}
+
+	testCases := []struct {
+		name    string
+		where   inmem.Predicate
+		setup   func(db *inmem.DB)
+		want    [][]byte
+		wantErr error
+	}{
+		{
+			name:  "should match an import time window",
+			where: inmem.Between("importTime", ts("2021-06-02T00:00:00Z"), ts("2021-06-03T12:00:00Z")),
+			setup: setup,
+			want:  [][]byte{[]byte("import2"), []byte("import3")},
+		},
+		{
+			name:  "should match greater than",
+			where: inmem.Gt("importTime", ts("2021-06-02T12:00:00Z")),
+			setup: setup,
+			want:  [][]byte{[]byte("import2"), []byte("import4")},
+		},
+		{
+			name:  "should match greater than or equal",
+			where: inmem.Gte("importTime", ts("2021-06-02T12:00:00Z")),
+			setup: setup,
+			want:  [][]byte{[]byte("import2"), []byte("import3"), []byte("import4")},
+		},
+		{
+			name:  "should match less than",
+			where: inmem.Lt("importTime", ts("2021-06-02T12:00:00Z")),
+			setup: setup,
+			want:  [][]byte{[]byte("import1")},
+		},
+		{
+			name:  "should match less than or equal",
+			where: inmem.Lte("importTime", ts("2021-06-02T12:00:00Z")),
+			setup: setup,
+			want:  [][]byte{[]byte("import1"), []byte("import3")},
+		},
+		{
+			name:  "should match prefix",
+			where: inmem.Prefix("fileName", "a/"),
+			setup: setup,
+			want:  [][]byte{[]byte("import1"), []byte("import2")},
+		},
+		{
+			name:  "should combine ranges with other predicates",
+			where: inmem.And(inmem.Gt("importTime", ts("2021-06-01T12:00:00Z")), inmem.Not(inmem.Prefix("fileName", "a"))),
+			setup: setup,
+			want:  [][]byte{[]byte("import3")},
+		},
+		{
+			name:  "should not match deleted or moved rows",
+			where: inmem.Lt("importTime", ts("2021-06-03T00:00:00Z")),
+			setup: func(db *inmem.DB) {
+				setup(db)
+				db.Delete(context.Background(), "imports", "fileName", "a/file1")
+				db.UpdateRow(context.Background(), "imports", "fileName", "b/file3", []string{"importTime"}, []string{ts("2021-06-05T00:00:00Z")}, []byte("import3"))
+			},
+			want: [][]byte{},
+		},
+		{
+			name:    "should fail due to column not being ordered",
+			where:   inmem.Gt("csid", "a"),
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotOrdered, Table: "imports", Column: "csid"},
+		},
+		{
+			name:    "should fail due to column not existing",
+			where:   inmem.Gt("winky wonky", "a"),
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotFound, Table: "imports", Column: "winky wonky"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{
+				{
+					Name:    "imports",
+					Columns: []string{"csid"},
+					Ordered: []string{"importTime", "fileName"},
+				},
+			})
+
+			if tc.setup != nil {
+				tc.setup(db)
+			}
+
+			got, gotErr := db.Query(context.Background(), "imports", tc.where)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, gotErr)
+				return
+			}
+
+			if !assert.Nil(t, gotErr) {
+				return
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB_QueryRange_ManyValues(t *testing.T) {
+
+	db := inmem.NewDB([]inmem.Table{
+		{
+			Name:    "imports",
+			Ordered: []string{"n"},
+		},
+	})
+
+	for _, i := range rand.New(rand.NewSource(1)).Perm(1000) {
+		n := fmt.Sprintf("%04d", i)
+		db.Insert(context.Background(), "imports", []string{"n"}, []string{n}, []byte(n))
+	}
+
+	for i := 0; i < 1000; i += 2 {
+		db.Delete(context.Background(), "imports", "n", fmt.Sprintf("%04d", i))
+	}
+
+	got, err := db.Query(context.Background(), "imports", inmem.Between("n", "0100", "0199"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Len(t, got, 50)
+	for _, d := range got {
+		assert.True(t, string(d) >= "0100" && string(d) <= "0199", "unexpected value %s", d)
+	}
+}
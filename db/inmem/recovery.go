@@ -0,0 +1,130 @@
+package inmem
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// RecoveryTarget is the point Recover restores a DB to. Build one with AtCommit or AtTime
+type RecoveryTarget struct {
+	ts uint64
+	at time.Time
+}
+
+// AtCommit targets commit ts, the log sequence number LastCommit returns. The recovered DB holds every commit and
+// schema change up to and including it
+func AtCommit(ts uint64) RecoveryTarget {
+	return RecoveryTarget{ts: ts}
+}
+
+// AtTime targets the DB as it was at t. The recovered DB holds every commit and schema change logged by then, as
+// told by the clock of the DB that logged them
+func AtTime(t time.Time) RecoveryTarget {
+	return RecoveryTarget{at: t}
+}
+
+// LastCommit returns the timestamp of the latest commit, which is its log sequence number in the log of a DB opened
+// with Open. Schema changes take a timestamp of their own as well
+func (db *DB) LastCommit() uint64 {
+	return atomic.LoadUint64(&db.clock)
+}
+
+// Recover builds a DB from the checkpoints and log Open wrote to dir, as it was at target. It loads the latest
+// checkpoint taken at or before target and replays the log after it, up to target. Targets past the end of the log
+// recover everything logged.
+//
+// The DB returned is held in memory only, like one built with LoadSnapshot; dir is only read, so Recover can run
+// against the dir of a DB that is still open. opts apply to the new DB as they do for NewDB. By default Open only keeps
+// the log since its latest checkpoint; use WithCheckpointRetention to keep more. Targets older than the checkpoints
+// and log kept fail with ErrNotRetained
+func Recover(dir string, target RecoveryTarget, opts ...Option) (*DB, error) {
+	names, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := target.ts
+	if !target.at.IsZero() {
+		if ts, err = commitAt(dir, names, target.at); err != nil {
+			return nil, err
+		}
+	}
+
+	db := NewDB(nil, opts...)
+	ckpt, err := db.loadCheckpoint(dir, ts)
+	if err != nil {
+		return nil, err
+	}
+	if ckpt == 0 && !fullLog(names) {
+		return nil, fmt.Errorf("%w: no checkpoint at or before commit %d", ErrNotRetained, ts)
+	}
+
+	for i, name := range names {
+		last := i == len(names)-1
+		if _, _, err := scanSegment(filepath.Join(dir, name), last, func(rec *logRecord) error {
+			if rec.ts <= ckpt || rec.ts > ts {
+				// in the checkpoint, or after the target. Commits can be logged slightly out of order, so the rest
+				// of the log is still read
+				return nil
+			}
+			return db.replay(rec, ckpt > 0)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range db.tables {
+		t.collect(atomic.LoadUint64(&db.clock))
+	}
+	db.sweepIfExpiring()
+
+	return db, nil
+}
+
+// commitAt returns the latest commit logged at or before t, in the segments names or in a checkpoint in dir taken by
+// then, since the log a checkpoint replaced may be gone
+func commitAt(dir string, names []string, t time.Time) (uint64, error) {
+	var ts uint64
+	found := false
+	for i, name := range names {
+		last := i == len(names)-1
+		if _, _, err := scanSegment(filepath.Join(dir, name), last, func(rec *logRecord) error {
+			if !rec.at.After(t) && rec.ts >= ts {
+				ts, found = rec.ts, true
+			}
+			return nil
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	ckpts, err := checkpoints(dir)
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range ckpts {
+		c, err := checkpointTS(name)
+		if err != nil {
+			continue
+		}
+		if at, ok := checkpointAt(name); ok && !at.After(t) && c >= ts {
+			ts, found = c, true
+		}
+	}
+
+	if !found && !fullLog(names) {
+		return 0, fmt.Errorf("%w: nothing logged at or before %s", ErrNotRetained, t.Format(time.RFC3339Nano))
+	}
+	return ts, nil
+}
+
+// fullLog reports whether the segments names are the whole log, none of it having been compacted away
+func fullLog(names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	seq, err := segmentSeq(names[0])
+	return err == nil && seq == 1
+}
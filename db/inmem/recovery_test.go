@@ -0,0 +1,185 @@
+package inmem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecover(t *testing.T) {
+
+	insert := func(db *inmem.DB, id string) error {
+		return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{id, "cs1"}, []byte(id))
+	}
+
+	// the log is stamped by the DB's clock, which is far from the real time so recovering by time can only work
+	// through it
+	clock := newFakeClock()
+
+	testCases := []struct {
+		name string
+		opts []inmem.Option
+		// write runs against the DB opened in the dir, returning the target to recover to
+		write   func(db *inmem.DB) (inmem.RecoveryTarget, error)
+		read    func(r reader) ([][]byte, error)
+		want    [][]byte
+		wantErr error
+	}{
+		{
+			name: "should recover to a commit",
+			write: func(db *inmem.DB) (inmem.RecoveryTarget, error) {
+				if err := insert(db, "import1"); err != nil {
+					return inmem.RecoveryTarget{}, err
+				}
+				target := inmem.AtCommit(db.LastCommit())
+				if err := insert(db, "import2"); err != nil {
+					return inmem.RecoveryTarget{}, err
+				}
+				return target, db.Delete(context.Background(), "imports", "id", "import1")
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1")},
+		},
+		{
+			name: "should recover to a time",
+			opts: []inmem.Option{inmem.WithClock(clock.Now)},
+			write: func(db *inmem.DB) (inmem.RecoveryTarget, error) {
+				if err := insert(db, "import1"); err != nil {
+					return inmem.RecoveryTarget{}, err
+				}
+				clock.Advance(time.Minute)
+				target := inmem.AtTime(clock.Now())
+				clock.Advance(time.Minute)
+				return target, insert(db, "import2")
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1")},
+		},
+		{
+			name: "should recover to a time after every commit",
+			opts: []inmem.Option{inmem.WithClock(clock.Now)},
+			write: func(db *inmem.DB) (inmem.RecoveryTarget, error) {
+				if err := insert(db, "import1"); err != nil {
+					return inmem.RecoveryTarget{}, err
+				}
+				return inmem.AtTime(clock.Now().Add(time.Hour)), insert(db, "import2")
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1"), []byte("import2")},
+		},
+		{
+			name: "should recover to a commit between retained checkpoints",
+			opts: []inmem.Option{inmem.WithCheckpointRetention(2)},
+			write: func(db *inmem.DB) (inmem.RecoveryTarget, error) {
+				ctx := context.Background()
+				for _, err := range []error{insert(db, "import1"), db.Checkpoint(ctx), insert(db, "import2")} {
+					if err != nil {
+						return inmem.RecoveryTarget{}, err
+					}
+				}
+				target := inmem.AtCommit(db.LastCommit())
+				for _, err := range []error{insert(db, "import3"), db.Checkpoint(ctx), insert(db, "import4")} {
+					if err != nil {
+						return inmem.RecoveryTarget{}, err
+					}
+				}
+				return target, nil
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1"), []byte("import2")},
+		},
+		{
+			name: "should recover to a time between retained checkpoints",
+			opts: []inmem.Option{inmem.WithClock(clock.Now), inmem.WithCheckpointRetention(2)},
+			write: func(db *inmem.DB) (inmem.RecoveryTarget, error) {
+				ctx := context.Background()
+				for _, err := range []error{insert(db, "import1"), db.Checkpoint(ctx)} {
+					if err != nil {
+						return inmem.RecoveryTarget{}, err
+					}
+				}
+				clock.Advance(time.Minute)
+				// the log up to the first checkpoint is compacted away by the second, leaving only the checkpoint
+				// from before the target
+				target := inmem.AtTime(clock.Now())
+				clock.Advance(time.Minute)
+				for _, err := range []error{insert(db, "import2"), db.Checkpoint(ctx), insert(db, "import3")} {
+					if err != nil {
+						return inmem.RecoveryTarget{}, err
+					}
+				}
+				return target, nil
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1")},
+		},
+		{
+			name: "should recover everything logged past the end of the log",
+			write: func(db *inmem.DB) (inmem.RecoveryTarget, error) {
+				if err := insert(db, "import1"); err != nil {
+					return inmem.RecoveryTarget{}, err
+				}
+				if err := db.Checkpoint(context.Background()); err != nil {
+					return inmem.RecoveryTarget{}, err
+				}
+				return inmem.AtCommit(db.LastCommit() + 100), insert(db, "import2")
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1"), []byte("import2")},
+		},
+		{
+			name: "should fail to recover to before the retained checkpoints",
+			write: func(db *inmem.DB) (inmem.RecoveryTarget, error) {
+				if err := insert(db, "import1"); err != nil {
+					return inmem.RecoveryTarget{}, err
+				}
+				target := inmem.AtCommit(db.LastCommit())
+				if err := insert(db, "import2"); err != nil {
+					return inmem.RecoveryTarget{}, err
+				}
+				return target, db.Checkpoint(context.Background())
+			},
+			wantErr: inmem.ErrNotRetained,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			dir := t.TempDir()
+			db, err := inmem.Open(dir, walTables, tc.opts...)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer db.Close()
+
+			target, err := tc.write(db)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			// the DB is still open while it is recovered
+			recovered, err := inmem.Recover(dir, target)
+			if tc.wantErr != nil {
+				assert.True(t, errors.Is(err, tc.wantErr), "got %v", err)
+				return
+			}
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			got, err := tc.read(recovered)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+
+			// the recovered DB takes writes of its own, which don't reach the log
+			assert.Nil(t, insert(recovered, "import9"))
+			got, err = db.Get(context.Background(), "imports", "id", "import9")
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{}, got)
+		})
+	}
+}
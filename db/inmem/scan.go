@@ -0,0 +1,123 @@
+package inmem
+
+import (
+	"context"
+)
+
+// scanBatchSize is how many rows Scan reads each time it takes the table's lock
+const scanBatchSize = 256
+
+// ScanOption configures a call to Scan
+type ScanOption func(*scanOptions)
+
+type scanOptions struct {
+	filter func(data []byte) bool
+}
+
+// WithDataFilter makes Scan skip the rows whose data filter returns false for, for conditions that can't be put on
+// indexed columns. filter is called with the table locked, so it must not use the DB
+func WithDataFilter(filter func(data []byte) bool) ScanOption {
+	return func(o *scanOptions) {
+		o.filter = filter
+	}
+}
+
+// Scan calls fn with every row in table matching where, in insertion order, as of a snapshot taken when it starts. A
+// nil where matches every row, so Scan can enumerate a whole table. Rows are read a batch at a time and fn is called
+// without holding any lock, so fn can take as long as it likes without holding up writers, and can use the DB
+//
+// Scan stops at the first error fn returns and returns it, except for ErrStopScan, which stops the scan and returns
+// nil. It also stops with ctx.Err() once ctx is done
+// EXAMPLE:
+//
+//	err := db.Scan(ctx, "profiles", nil, func(row inmem.Row) error {
+//		return enc.Encode(row)
+//	})
+func (db *DB) Scan(ctx context.Context, table string, where Predicate, fn func(Row) error, opts ...ScanOption) error {
+	// unlike the DB's other reads, the snapshot is registered, so the table's lock can be let go between batches
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	return tx.Scan(ctx, table, where, fn, opts...)
+}
+
+// Scan calls fn with every row in table matching where, in insertion order, as the transaction sees them. See
+// DB.Scan. fn may use the transaction, but rows it inserts into table aren't visited
+func (tx *Tx) Scan(ctx context.Context, table string, where Predicate, fn func(Row) error, opts ...ScanOption) error {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	var o scanOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if where == nil {
+		where = And()
+	}
+
+	v, unlock, err := tx.rview(ctx, table)
+	if err != nil {
+		return err
+	}
+	candidates, err := v.candidates(ctx, where)
+	// the candidates are read once the lock is released, when the indexes may change under them
+	candidates = append([]rowID(nil), candidates...)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	for len(candidates) > 0 {
+		batch := candidates
+		if len(batch) > scanBatchSize {
+			batch = batch[:scanBatchSize]
+		}
+		candidates = candidates[len(batch):]
+
+		rows, err := tx.scanBatch(ctx, table, where, o.filter, batch)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range rows {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(r); err != nil {
+				if err == ErrStopScan {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// scanBatch returns the rows among candidates matching where and filter, holding the table's read lock while it reads
+// them
+func (tx *Tx) scanBatch(ctx context.Context, table string, where Predicate, filter func([]byte) bool, candidates []rowID) ([]Row, error) {
+	v, unlock, err := tx.rview(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	rows := make([]Row, 0, len(candidates))
+	rowIDs := make([]rowID, 0, len(candidates))
+	for _, rid := range candidates {
+		ver, found := v.lookup(rid)
+		if !found || !where.match(ver.vals) || filter != nil && !filter(ver.data) {
+			continue
+		}
+		rows = append(rows, newRow(table, ver))
+		rowIDs = append(rowIDs, rid)
+	}
+	v.access(rowIDs)
+
+	return rows, nil
+}
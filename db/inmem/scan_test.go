@@ -0,0 +1,155 @@
+package inmem_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Scan(t *testing.T) {
+
+	errStop := errors.New("stop")
+
+	testCases := []struct {
+		name  string
+		where inmem.Predicate
+		opts  []inmem.ScanOption
+		// stop is returned by fn once it has seen that many rows, if set
+		stop    error
+		stopAt  int
+		want    []inmem.Row
+		wantErr error
+	}{
+		{
+			name: "should visit every row without a predicate",
+			want: []inmem.Row{
+				{Table: "imports", Cols: []string{"csid", "id"}, Vals: []string{"cs1", "import1"}, Data: []byte(`{"status":"done"}`)},
+				{Table: "imports", Cols: []string{"csid", "id"}, Vals: []string{"cs2", "import2"}, Data: []byte(`{"status":"failed"}`)},
+				{Table: "imports", Cols: []string{"csid", "id"}, Vals: []string{"cs1", "import3"}, Data: []byte(`{"status":"failed"}`)},
+			},
+		},
+		{
+			name:  "should only visit rows matching the predicate",
+			where: inmem.Eq("csid", "cs1"),
+			want: []inmem.Row{
+				{Table: "imports", Cols: []string{"csid", "id"}, Vals: []string{"cs1", "import1"}, Data: []byte(`{"status":"done"}`)},
+				{Table: "imports", Cols: []string{"csid", "id"}, Vals: []string{"cs1", "import3"}, Data: []byte(`{"status":"failed"}`)},
+			},
+		},
+		{
+			name: "should only visit rows whose data passes the filter",
+			opts: []inmem.ScanOption{inmem.WithDataFilter(func(data []byte) bool {
+				return bytes.Contains(data, []byte("failed"))
+			})},
+			want: []inmem.Row{
+				{Table: "imports", Cols: []string{"csid", "id"}, Vals: []string{"cs2", "import2"}, Data: []byte(`{"status":"failed"}`)},
+				{Table: "imports", Cols: []string{"csid", "id"}, Vals: []string{"cs1", "import3"}, Data: []byte(`{"status":"failed"}`)},
+			},
+		},
+		{
+			name:   "should stop without an error on ErrStopScan",
+			stop:   inmem.ErrStopScan,
+			stopAt: 1,
+			want: []inmem.Row{
+				{Table: "imports", Cols: []string{"csid", "id"}, Vals: []string{"cs1", "import1"}, Data: []byte(`{"status":"done"}`)},
+			},
+		},
+		{
+			name:   "should stop with the error fn returns",
+			stop:   errStop,
+			stopAt: 2,
+			want: []inmem.Row{
+				{Table: "imports", Cols: []string{"csid", "id"}, Vals: []string{"cs1", "import1"}, Data: []byte(`{"status":"done"}`)},
+				{Table: "imports", Cols: []string{"csid", "id"}, Vals: []string{"cs2", "import2"}, Data: []byte(`{"status":"failed"}`)},
+			},
+			wantErr: errStop,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctx := context.Background()
+			db := inmem.NewDB(walTables)
+			for i, csid := range []string{"cs1", "cs2", "cs1"} {
+				data := `{"status":"failed"}`
+				if i == 0 {
+					data = `{"status":"done"}`
+				}
+				if !assert.Nil(t, db.Insert(ctx, "imports", []string{"id", "csid"}, []string{fmt.Sprintf("import%d", i+1), csid}, []byte(data))) {
+					return
+				}
+			}
+
+			var got []inmem.Row
+			err := db.Scan(ctx, "imports", tc.where, func(row inmem.Row) error {
+				got = append(got, row)
+				if tc.stop != nil && len(got) == tc.stopAt {
+					return tc.stop
+				}
+				return nil
+			}, tc.opts...)
+
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB_ScanLarge(t *testing.T) {
+
+	ctx := context.Background()
+	db := inmem.NewDB(walTables)
+	const rows = 1000
+	for i := 0; i < rows; i++ {
+		id := fmt.Sprintf("user%04d", i)
+		if !assert.Nil(t, db.Insert(ctx, "profiles", []string{"id"}, []string{id}, []byte(id))) {
+			return
+		}
+	}
+
+	t.Run("should visit rows as of when the scan started while fn writes to the table", func(t *testing.T) {
+		seen := 0
+		err := db.Scan(ctx, "profiles", nil, func(row inmem.Row) error {
+			if string(row.Data) != fmt.Sprintf("user%04d", seen) {
+				return fmt.Errorf("got %s at %d", row.Data, seen)
+			}
+			seen++
+
+			if seen == 1 {
+				return db.Insert(ctx, "profiles", []string{"id"}, []string{"user9999"}, []byte("user9999"))
+			}
+			if seen == rows/2 {
+				return db.Delete(ctx, "profiles", "id", fmt.Sprintf("user%04d", rows-1))
+			}
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, rows, seen)
+	})
+
+	t.Run("should stop once the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		seen := 0
+		err := db.Scan(ctx, "profiles", nil, func(row inmem.Row) error {
+			seen++
+			if seen == 10 {
+				cancel()
+			}
+			return nil
+		})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 10, seen)
+	})
+
+	t.Run("should fail for an unknown table", func(t *testing.T) {
+		err := db.Scan(ctx, "files", nil, func(inmem.Row) error { return nil })
+		assert.Equal(t, &inmem.Error{Err: inmem.ErrTableNotFound, Table: "files"}, err)
+	})
+}
@@ -0,0 +1,106 @@
+package inmem
+
+import "math/rand"
+
+const maxLevel = 24
+
+// skiplist is a sorted set of column values backing an ordered column. It only holds the distinct values; the rows for
+// each value live in the column's bucket like any other column
+type skiplist struct {
+	head  *node
+	level int
+	rnd   *rand.Rand
+}
+
+type node struct {
+	v    val
+	next []*node
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:  &node{next: make([]*node, maxLevel)},
+		level: 1,
+		rnd:   rand.New(rand.NewSource(1)),
+	}
+}
+
+// insert adds v to the list. Adding a value already in the list is a no-op
+func (s *skiplist) insert(v val) {
+	var update [maxLevel]*node
+	n := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].v < v {
+			n = n.next[i]
+		}
+		update[i] = n
+	}
+
+	if n.next[0] != nil && n.next[0].v == v {
+		return
+	}
+
+	level := s.randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = s.head
+		}
+		s.level = level
+	}
+
+	x := &node{v: v, next: make([]*node, level)}
+	for i := 0; i < level; i++ {
+		x.next[i] = update[i].next[i]
+		update[i].next[i] = x
+	}
+}
+
+// remove deletes v from the list if it is present
+func (s *skiplist) remove(v val) {
+	var update [maxLevel]*node
+	n := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].v < v {
+			n = n.next[i]
+		}
+		update[i] = n
+	}
+
+	x := n.next[0]
+	if x == nil || x.v != v {
+		return
+	}
+
+	for i := 0; i < len(x.next); i++ {
+		update[i].next[i] = x.next[i]
+	}
+
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+}
+
+// seek returns the first node with a value >= v, or nil if there is none
+func (s *skiplist) seek(v val) *node {
+	n := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for n.next[i] != nil && n.next[i].v < v {
+			n = n.next[i]
+		}
+	}
+
+	return n.next[0]
+}
+
+// first returns the node with the smallest value, or nil if the list is empty
+func (s *skiplist) first() *node {
+	return s.head.next[0]
+}
+
+func (s *skiplist) randomLevel() int {
+	level := 1
+	for level < maxLevel && s.rnd.Intn(4) == 0 {
+		level++
+	}
+	return level
+}
@@ -0,0 +1,391 @@
+package inmem
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// snapshotMagic starts every snapshot
+var snapshotMagic = []byte("INMEMSNP")
+
+// snapshotVersion is the version of the snapshot format written by SaveSnapshot. Snapshots written by earlier versions,
+// before rows could expire or tables had limits, are still read
+const snapshotVersion = 3
+
+// A snapshot is laid out as:
+//
+//	magic      [8]byte "INMEMSNP"
+//	version    uint32
+//	commit ts  uint64  the commit the snapshot was taken at
+//	tables     uint32  followed by each table:
+//	  name, pk string
+//	  strict   bool
+//	  columns, ordered, unique []string
+//	  ttl      uint64  nanoseconds, from version 2
+//	  max rows, max bytes uint64, from version 3
+//	  eviction string, from version 3
+//	  next id  uint64
+//	  rows     uint32  followed by each row:
+//	    id     uint64
+//	    data   []byte
+//	    vals   uint32  followed by each column name and value, as strings
+//	    expiry uint64  nanoseconds since the Unix epoch, 0 if the row doesn't expire, from version 2
+//	crc32      uint32  IEEE checksum of everything before it
+//
+// Integers are big endian; strings, byte slices and lists are prefixed with their uint32 length. Only the rows
+// visible at the commit are written, and the column indexes are written as the list of columns; their buckets and
+// ordered values are rebuilt from the rows on load
+
+// tableSnapshot is one table as of a commit
+type tableSnapshot struct {
+	def    Table
+	nextID rowID
+	rows   []snapshotRow
+}
+
+type snapshotRow struct {
+	id      rowID
+	vals    map[colName]val
+	data    []byte
+	expires time.Time
+}
+
+// SaveSnapshot writes the definition and rows of every table, as of the latest commit, to w. It reads through a
+// snapshot like a Tx, so writers carry on while it runs. Load it back with LoadSnapshot
+func (db *DB) SaveSnapshot(w io.Writer) error {
+	_, err := db.saveSnapshot(context.Background(), w)
+	return err
+}
+
+// saveSnapshot writes a snapshot to w, returning the commit timestamp it was taken at
+func (db *DB) saveSnapshot(ctx context.Context, w io.Writer) (uint64, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	tables, err := tx.tableSnapshots(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return tx.snap, writeSnapshot(w, tx.snap, tables)
+}
+
+// tableSnapshots returns every table as the transaction sees it, in name order
+func (tx *Tx) tableSnapshots(ctx context.Context) ([]tableSnapshot, error) {
+	tx.db.mu.RLock()
+	names := make([]string, 0, len(tx.db.tables))
+	for name := range tx.db.tables {
+		names = append(names, name)
+	}
+	tx.db.mu.RUnlock()
+	sort.Strings(names)
+
+	tables := make([]tableSnapshot, 0, len(names))
+	for _, name := range names {
+		snap, err := tx.tableSnapshot(ctx, name)
+		if errors.Is(err, ErrTableNotFound) {
+			// dropped since the names were listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		tables = append(tables, snap)
+	}
+
+	return tables, nil
+}
+
+// tableSnapshot returns table name as the transaction sees it
+func (tx *Tx) tableSnapshot(ctx context.Context, name string) (tableSnapshot, error) {
+	v, unlock, err := tx.rview(ctx, name)
+	if err != nil {
+		return tableSnapshot{}, err
+	}
+	defer unlock()
+
+	snap := tableSnapshot{def: v.t.def(), nextID: v.t.nextID}
+	rowIDs, err := v.rowIDs(ctx)
+	if err != nil {
+		return tableSnapshot{}, err
+	}
+	for i, rid := range rowIDs {
+		if i%scanCheckInterval == 0 && i > 0 {
+			if err := v.pause(ctx); err != nil {
+				return tableSnapshot{}, err
+			}
+		}
+
+		if ver, found := v.lookup(rid); found {
+			snap.rows = append(snap.rows, snapshotRow{id: rid, vals: ver.vals, data: ver.data, expires: ver.expires})
+		}
+	}
+
+	return snap, nil
+}
+
+func writeSnapshot(w io.Writer, ts uint64, tables []tableSnapshot) error {
+	h := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+	e := &encoder{w: bw}
+
+	e.write(snapshotMagic)
+	e.uint32(snapshotVersion)
+	e.uint64(ts)
+
+	e.uint32(uint32(len(tables)))
+	for _, t := range tables {
+		e.table(t.def)
+		e.options(t.def)
+		e.uint64(uint64(t.nextID))
+
+		e.uint32(uint32(len(t.rows)))
+		for _, r := range t.rows {
+			e.uint64(uint64(r.id))
+			e.bytes(r.data)
+			e.vals(r.vals)
+			e.time(r.expires)
+		}
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	// the checksum goes straight to w, since it doesn't cover itself
+	e = &encoder{w: w}
+	e.uint32(h.Sum32())
+	return e.err
+}
+
+// table writes a table definition
+func (e *encoder) table(def Table) {
+	e.string(def.Name)
+	e.string(def.PrimaryKey)
+	e.bool(def.Strict)
+	e.strings(def.Columns)
+	e.strings(def.Ordered)
+	e.strings(def.Unique)
+}
+
+func (d *decoder) table() Table {
+	return Table{
+		Name:       d.string(),
+		PrimaryKey: d.string(),
+		Strict:     d.bool(),
+		Columns:    d.strings(),
+		Ordered:    d.strings(),
+		Unique:     d.strings(),
+	}
+}
+
+// options writes the parts of a table definition added to the format after the first version, which follow the rest
+// of the definition
+func (e *encoder) options(def Table) {
+	e.uint64(uint64(def.TTL))
+	e.uint64(uint64(def.MaxRows))
+	e.uint64(uint64(def.MaxBytes))
+	e.string(def.Eviction)
+}
+
+// options reads the options written by a snapshot of the given version into def
+func (d *decoder) options(def *Table, version uint32) {
+	if version >= 2 {
+		def.TTL = time.Duration(d.uint64())
+	}
+	if version >= 3 {
+		def.MaxRows = int(d.uint64())
+		def.MaxBytes = int64(d.uint64())
+		def.Eviction = d.string()
+	}
+}
+
+// vals writes a row's column values in column order
+func (e *encoder) vals(vals map[colName]val) {
+	cols := make([]string, 0, len(vals))
+	for c := range vals {
+		cols = append(cols, string(c))
+	}
+	sort.Strings(cols)
+
+	e.uint32(uint32(len(cols)))
+	for _, c := range cols {
+		e.string(c)
+		e.string(string(vals[colName(c)]))
+	}
+}
+
+func (d *decoder) vals() map[colName]val {
+	n := d.uint32()
+	if d.err != nil || int(n) > len(d.b) {
+		d.err = errShortBuffer
+		return nil
+	}
+
+	vals := make(map[colName]val, n)
+	for i := uint32(0); i < n; i++ {
+		c := d.string()
+		vals[colName(c)] = val(d.string())
+	}
+	return vals
+}
+
+// LoadSnapshot builds a DB from a snapshot written by SaveSnapshot. Every table is restored with the rows it held when
+// the snapshot was taken, so reads return exactly what they did then. opts apply to the new DB as they do for NewDB.
+// Tables whose eviction policy isn't registered fail with ErrUnknownEviction
+func LoadSnapshot(r io.Reader, opts ...Option) (*DB, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ts, tables, err := readSnapshot(b)
+	if err != nil {
+		return nil, err
+	}
+
+	db := NewDB(nil, opts...)
+	if err := db.restore(ts, tables); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func readSnapshot(b []byte) (uint64, []tableSnapshot, error) {
+	if len(b) < len(snapshotMagic)+4 || !bytes.Equal(b[:len(snapshotMagic)], snapshotMagic) {
+		return 0, nil, fmt.Errorf("%w: not a snapshot", ErrBadSnapshot)
+	}
+
+	body, sum := b[:len(b)-4], b[len(b)-4:]
+	if crc32.ChecksumIEEE(body) != (&decoder{b: sum}).uint32() {
+		return 0, nil, fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+
+	d := &decoder{b: body[len(snapshotMagic):]}
+	version := d.uint32()
+	if version < 1 || version > snapshotVersion {
+		return 0, nil, fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, version)
+	}
+	ts := d.uint64()
+
+	tables := make([]tableSnapshot, d.uint32())
+	for i := range tables {
+		if d.err != nil {
+			break
+		}
+
+		t := &tables[i]
+		t.def = d.table()
+		d.options(&t.def, version)
+		t.nextID = rowID(d.uint64())
+
+		n := d.uint32()
+		for j := uint32(0); j < n && d.err == nil; j++ {
+			r := snapshotRow{
+				id:   rowID(d.uint64()),
+				data: d.bytes(),
+				vals: d.vals(),
+			}
+			if version >= 2 {
+				r.expires = d.time()
+			}
+			t.rows = append(t.rows, r)
+		}
+	}
+
+	if d.err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrBadSnapshot, d.err)
+	}
+	if len(d.b) > 0 {
+		return 0, nil, fmt.Errorf("%w: %d bytes of trailing data", ErrBadSnapshot, len(d.b))
+	}
+
+	return ts, tables, nil
+}
+
+// restore replaces the DB's tables with tables, as of commit ts. It must only be called before the DB is shared. It
+// fails with ErrUnknownEviction, restoring nothing, if a table's eviction policy isn't registered
+func (db *DB) restore(ts uint64, tables []tableSnapshot) error {
+	for _, snap := range tables {
+		if err := checkEviction(snap.def); err != nil {
+			return err
+		}
+	}
+
+	db.tables = make(map[string]*table, len(tables))
+	for _, snap := range tables {
+		if db.strict {
+			snap.def.Strict = true
+		}
+
+		t := newTable(snap.def)
+		t.nextID = snap.nextID
+		for _, r := range snap.rows {
+			ver := &version{ts: ts, vals: r.vals, data: r.data, expires: r.expires}
+			t.rowData[r.id] = &record{versions: ver}
+			t.track(r.id, nil, ver)
+			if !r.expires.IsZero() {
+				t.expiring[r.id] = true
+			}
+			for c, v := range r.vals {
+				t.index(c, v, r.id)
+			}
+		}
+		db.tables[t.name] = t
+	}
+
+	db.issued = ts
+	atomic.StoreUint64(&db.clock, ts)
+	db.sweepIfExpiring()
+
+	return nil
+}
+
+// def returns the table's definition. Columns lists every column the table has, including the ordered and unique
+// ones
+func (t *table) def() Table {
+	def := Table{
+		Name:       t.name,
+		PrimaryKey: string(t.pk),
+		Strict:     t.strict,
+		TTL:        t.ttl,
+		MaxRows:    t.maxRows,
+		MaxBytes:   t.maxBytes,
+		Eviction:   t.eviction,
+		Columns:    make([]string, 0, len(t.rows)),
+	}
+
+	for c := range t.rows {
+		def.Columns = append(def.Columns, string(c))
+	}
+	for c := range t.ordered {
+		def.Ordered = append(def.Ordered, string(c))
+	}
+	for c := range t.unique {
+		if c != t.pk {
+			def.Unique = append(def.Unique, string(c))
+		}
+	}
+
+	sort.Strings(def.Columns)
+	sort.Strings(def.Ordered)
+	sort.Strings(def.Unique)
+
+	return def
+}
@@ -0,0 +1,189 @@
+package inmem_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+// snapshotDB builds a DB with a mix of rows, updates and deletes to save
+func snapshotDB(t *testing.T) *inmem.DB {
+	db := inmem.NewDB([]inmem.Table{
+		{Name: "imports", Columns: []string{"csid"}, Ordered: []string{"fileName"}, Unique: []string{"id"}},
+		{Name: "profiles", PrimaryKey: "id", Strict: true},
+	})
+
+	ctx := context.Background()
+	for _, err := range []error{
+		db.Insert(ctx, "imports", []string{"id", "csid", "fileName"}, []string{"import1", "cs1", "a/file1"}, []byte("import1")),
+		db.Insert(ctx, "imports", []string{"id", "csid", "fileName"}, []string{"import2", "cs1", "b/file2"}, []byte("import2")),
+		db.Insert(ctx, "imports", []string{"id", "csid", "fileName"}, []string{"import3", "cs2", "b/file3"}, []byte("import3")),
+		db.Delete(ctx, "imports", "id", "import2"),
+		db.UpdateRow(ctx, "imports", "id", "import3", []string{"csid"}, []string{"cs1"}, []byte("import3-moved")),
+		db.Insert(ctx, "profiles", []string{"id"}, []string{"user1"}, []byte("profile1")),
+		db.Insert(ctx, "profiles", []string{"id"}, []string{"user2"}, []byte{}),
+		db.Insert(ctx, "profiles", []string{"id"}, []string{"user3"}, nil),
+	} {
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+	}
+
+	return db
+}
+
+func TestDB_Snapshot(t *testing.T) {
+
+	testCases := []struct {
+		name string
+		// after runs against the loaded DB before read
+		after   func(db *inmem.DB) error
+		read    func(r reader) ([][]byte, error)
+		want    [][]byte
+		wantErr error
+	}{
+		{
+			name: "should restore rows by column",
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1"), []byte("import3-moved")},
+		},
+		{
+			name: "should not restore deleted rows",
+			read: getRows("imports", "id", "import2"),
+			want: [][]byte{},
+		},
+		{
+			name: "should not restore values rows no longer hold",
+			read: getRows("imports", "csid", "cs2"),
+			want: [][]byte{},
+		},
+		{
+			name: "should restore ordered columns",
+			read: func(r reader) ([][]byte, error) {
+				return r.Query(context.Background(), "imports", inmem.Prefix("fileName", "b/"))
+			},
+			want: [][]byte{[]byte("import3-moved")},
+		},
+		{
+			name: "should restore primary keys",
+			read: func(r reader) ([][]byte, error) {
+				data, err := r.GetByKey(context.Background(), "profiles", "user1")
+				return [][]byte{data}, err
+			},
+			want: [][]byte{[]byte("profile1")},
+		},
+		{
+			name: "should restore empty and nil data as they were written",
+			read: func(r reader) ([][]byte, error) {
+				empty, err := r.GetByKey(context.Background(), "profiles", "user2")
+				if err != nil {
+					return nil, err
+				}
+				none, err := r.GetByKey(context.Background(), "profiles", "user3")
+				return [][]byte{empty, none}, err
+			},
+			want: [][]byte{{}, nil},
+		},
+		{
+			name: "should keep insertion order for new rows",
+			after: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import4", "cs1"}, []byte("import4"))
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1"), []byte("import3-moved"), []byte("import4")},
+		},
+		{
+			name: "should restore unique constraints",
+			after: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "imports", []string{"id"}, []string{"import1"}, []byte("import1-again"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrUniqueViolation, Table: "imports", Column: "id", Value: "import1"},
+		},
+		{
+			name: "should restore strict tables",
+			after: func(db *inmem.DB) error {
+				return db.Insert(context.Background(), "profiles", []string{"id", "nickname"}, []string{"user2", "two"}, []byte("profile2"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrColumnNotDeclared, Table: "profiles", Column: "nickname"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+			if !assert.Nil(t, snapshotDB(t).SaveSnapshot(&buf)) {
+				return
+			}
+
+			db, err := inmem.LoadSnapshot(&buf)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			if tc.after != nil {
+				err := tc.after(db)
+				if tc.wantErr != nil {
+					assert.Equal(t, tc.wantErr, err)
+					return
+				}
+				if !assert.Nil(t, err) {
+					return
+				}
+			}
+
+			got, err := tc.read(db)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLoadSnapshot_Bad(t *testing.T) {
+
+	var buf bytes.Buffer
+	if !assert.Nil(t, snapshotDB(t).SaveSnapshot(&buf)) {
+		return
+	}
+	good := buf.Bytes()
+
+	testCases := []struct {
+		name    string
+		corrupt func(b []byte) []byte
+	}{
+		{
+			name:    "should reject empty input",
+			corrupt: func(b []byte) []byte { return nil },
+		},
+		{
+			name: "should reject input that isn't a snapshot",
+			corrupt: func(b []byte) []byte {
+				return append([]byte("NOTASNAP"), b[8:]...)
+			},
+		},
+		{
+			name: "should reject a flipped bit",
+			corrupt: func(b []byte) []byte {
+				b[len(b)/2] ^= 1
+				return b
+			},
+		},
+		{
+			name: "should reject a truncated snapshot",
+			corrupt: func(b []byte) []byte {
+				return b[:len(b)-10]
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			b := tc.corrupt(append([]byte(nil), good...))
+			_, err := inmem.LoadSnapshot(bytes.NewReader(b))
+			assert.True(t, errors.Is(err, inmem.ErrBadSnapshot), "got %v", err)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package inmem
+
+import (
+	"context"
+	"time"
+)
+
+// defaultSweepInterval is how often expired rows are swept unless WithSweepInterval says otherwise
+const defaultSweepInterval = time.Minute
+
+// WithClock makes the DB tell the time with now instead of time.Now, deciding when rows expire. Tests use it to expire
+// rows without waiting
+func WithClock(now func() time.Time) Option {
+	return func(db *DB) {
+		db.now = now
+	}
+}
+
+// WithSweepInterval makes the DB sweep expired rows every d in the background, instead of every minute. A d of 0 or
+// less turns background sweeping off, leaving it to SweepExpired
+func WithSweepInterval(d time.Duration) Option {
+	return func(db *DB) {
+		db.sweepInterval = d
+	}
+}
+
+// expire gives ver the table's TTL, if it has one and ver has no expiry of its own
+func (v *view) expire(ver *version) {
+	if ver.expires.IsZero() && v.t.ttl > 0 {
+		ver.expires = v.now.Add(v.t.ttl)
+	}
+}
+
+// SweepExpired removes every expired row from its table's rows and indexes, returning how many were removed. Expired
+// rows are already invisible to reads, so sweeping only frees the memory they hold. The DB sweeps in the background
+// once it holds rows that expire; SweepExpired sweeps straight away
+func (db *DB) SweepExpired(ctx context.Context) (int, error) {
+	db.mu.RLock()
+	tables := make([]*table, 0, len(db.tables))
+	for _, t := range db.tables {
+		tables = append(tables, t)
+	}
+	db.mu.RUnlock()
+
+	now := db.now()
+	swept := 0
+	for _, t := range tables {
+		if err := t.mu.lock(ctx); err != nil {
+			return swept, err
+		}
+		swept += t.sweep(now, db.horizon())
+		t.mu.unlock()
+	}
+
+	return swept, nil
+}
+
+// sweep removes the rows whose newest version has expired as of now from rowData and every index, returning how many
+// were removed. Rows with older versions that snapshots before horizon may still see are left for a later sweep
+func (t *table) sweep(now time.Time, horizon uint64) int {
+	swept := 0
+	for rid := range t.expiring {
+		rec := t.rowData[rid]
+		if !rec.versions.expired(now) || rec.versions.prev != nil && rec.versions.ts > horizon {
+			continue
+		}
+
+		t.track(rid, rec.versions, nil)
+		for ver := rec.versions; ver != nil; ver = ver.prev {
+			for c, v := range ver.vals {
+				t.unindex(c, v, rid)
+			}
+		}
+		delete(t.rowData, rid)
+		delete(t.expiring, rid)
+		swept++
+	}
+
+	return swept
+}
+
+// sweepIfExpiring starts the sweeper if any table holds rows that expire. It must only be called before the DB is
+// shared, once its tables are restored
+func (db *DB) sweepIfExpiring() {
+	for _, t := range db.tables {
+		if len(t.expiring) > 0 {
+			db.startSweeper()
+			return
+		}
+	}
+}
+
+// startSweeper starts sweeping expired rows in the background, unless it has already started, background sweeping is
+// off or the DB is closed
+func (db *DB) startSweeper() {
+	db.sweepOnce.Do(func() {
+		if db.sweepInterval <= 0 {
+			return
+		}
+
+		select {
+		case <-db.closing:
+			return
+		default:
+		}
+
+		db.background.Add(1)
+		go db.sweeper()
+	})
+}
+
+// sweeper sweeps expired rows every sweep interval until the DB is closed
+func (db *DB) sweeper() {
+	defer db.background.Done()
+
+	ticker := time.NewTicker(db.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.closing:
+			return
+		case <-ticker.C:
+			// a background context is never done, so sweeping can't fail
+			_, _ = db.SweepExpired(context.Background())
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package inmem_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock that only moves when told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+var ttlTables = []inmem.Table{
+	{Name: "imports", Columns: []string{"csid"}, Unique: []string{"id"}},
+	{Name: "statuses", Columns: []string{"csid"}, PrimaryKey: "id", TTL: time.Minute},
+}
+
+func TestDB_Expiry(t *testing.T) {
+
+	testCases := []struct {
+		name string
+		// write runs against the DB, moving the clock on as it goes
+		write   func(db *inmem.DB, clock *fakeClock) error
+		read    func(r reader) ([][]byte, error)
+		want    [][]byte
+		wantErr error
+		// wantSwept is how many rows SweepExpired removes once read
+		wantSwept int
+	}{
+		{
+			name: "should not return rows once they expire",
+			write: func(db *inmem.DB, clock *fakeClock) error {
+				ctx := context.Background()
+				for _, err := range []error{
+					db.InsertWithExpiry(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1"), clock.Now().Add(time.Second)),
+					db.InsertWithExpiry(ctx, "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, []byte("import2"), clock.Now().Add(time.Hour)),
+					db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import3", "cs1"}, []byte("import3")),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				clock.Advance(time.Second)
+				return nil
+			},
+			read:      getRows("imports", "csid", "cs1"),
+			want:      [][]byte{[]byte("import2"), []byte("import3")},
+			wantSwept: 1,
+		},
+		{
+			name: "should expire rows after the table's TTL",
+			write: func(db *inmem.DB, clock *fakeClock) error {
+				ctx := context.Background()
+				if err := db.Insert(ctx, "statuses", []string{"id", "csid"}, []string{"status1", "cs1"}, []byte("status1")); err != nil {
+					return err
+				}
+				clock.Advance(30 * time.Second)
+				if err := db.Insert(ctx, "statuses", []string{"id", "csid"}, []string{"status2", "cs1"}, []byte("status2")); err != nil {
+					return err
+				}
+				clock.Advance(30 * time.Second)
+				return nil
+			},
+			read:      getRows("statuses", "csid", "cs1"),
+			want:      [][]byte{[]byte("status2")},
+			wantSwept: 1,
+		},
+		{
+			name: "should restart the table's TTL on upsert",
+			write: func(db *inmem.DB, clock *fakeClock) error {
+				ctx := context.Background()
+				if err := db.Upsert(ctx, "statuses", []string{"id", "csid"}, []string{"status1", "cs1"}, []byte("status1")); err != nil {
+					return err
+				}
+				clock.Advance(30 * time.Second)
+				if err := db.Upsert(ctx, "statuses", []string{"id", "csid"}, []string{"status1", "cs1"}, []byte("status1-again")); err != nil {
+					return err
+				}
+				clock.Advance(30 * time.Second)
+				return nil
+			},
+			read: func(r reader) ([][]byte, error) {
+				data, err := r.GetByKey(context.Background(), "statuses", "status1")
+				return [][]byte{data}, err
+			},
+			want: [][]byte{[]byte("status1-again")},
+		},
+		{
+			name: "should keep a row's expiry when it is updated",
+			write: func(db *inmem.DB, clock *fakeClock) error {
+				ctx := context.Background()
+				if err := db.InsertWithExpiry(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1"), clock.Now().Add(time.Second)); err != nil {
+					return err
+				}
+				if err := db.Update(ctx, "imports", "id", "import1", []byte("import1-updated")); err != nil {
+					return err
+				}
+				clock.Advance(time.Second)
+				return nil
+			},
+			read:      getRows("imports", "csid", "cs1"),
+			want:      [][]byte{},
+			wantSwept: 1,
+		},
+		{
+			name: "should move a row's expiry with UpdateWithExpiry",
+			write: func(db *inmem.DB, clock *fakeClock) error {
+				ctx := context.Background()
+				for _, err := range []error{
+					db.InsertWithExpiry(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1"), clock.Now().Add(time.Second)),
+					db.InsertWithExpiry(ctx, "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, []byte("import2"), clock.Now().Add(time.Second)),
+					db.UpdateWithExpiry(ctx, "imports", "id", "import1", []byte("import1-extended"), clock.Now().Add(time.Hour)),
+					db.UpdateWithExpiry(ctx, "imports", "id", "import2", []byte("import2-kept"), time.Time{}),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				clock.Advance(time.Minute)
+				return nil
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1-extended"), []byte("import2-kept")},
+		},
+		{
+			name: "should not update expired rows",
+			write: func(db *inmem.DB, clock *fakeClock) error {
+				ctx := context.Background()
+				if err := db.InsertWithExpiry(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1"), clock.Now().Add(time.Second)); err != nil {
+					return err
+				}
+				clock.Advance(time.Second)
+				return db.Update(ctx, "imports", "id", "import1", []byte("import1-updated"))
+			},
+			wantErr: &inmem.Error{Err: inmem.ErrValueNotFound, Table: "imports", Column: "id", Value: "import1"},
+		},
+		{
+			name: "should free unique values when rows expire",
+			write: func(db *inmem.DB, clock *fakeClock) error {
+				ctx := context.Background()
+				if err := db.InsertWithExpiry(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1"), clock.Now().Add(time.Second)); err != nil {
+					return err
+				}
+				clock.Advance(time.Second)
+				return db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1-again"))
+			},
+			read:      getRows("imports", "id", "import1"),
+			want:      [][]byte{[]byte("import1-again")},
+			wantSwept: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			clock := newFakeClock()
+			db := inmem.NewDB(ttlTables, inmem.WithClock(clock.Now), inmem.WithSweepInterval(0))
+
+			err := tc.write(db, clock)
+			if tc.wantErr != nil {
+				assert.Equal(t, tc.wantErr, err)
+				return
+			}
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			got, err := tc.read(db)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+
+			swept, err := db.SweepExpired(context.Background())
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantSwept, swept)
+
+			// reads are the same once the expired rows are gone
+			got, err = tc.read(db)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDB_ExpiryPersisted(t *testing.T) {
+
+	write := func(db *inmem.DB, clock *fakeClock) error {
+		ctx := context.Background()
+		if err := db.InsertWithExpiry(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1"), clock.Now().Add(time.Second)); err != nil {
+			return err
+		}
+		return db.Insert(ctx, "statuses", []string{"id", "csid"}, []string{"status1", "cs1"}, []byte("status1"))
+	}
+
+	testCases := []struct {
+		name string
+		// reopen writes to a DB using clock and returns it as reloaded
+		reopen func(t *testing.T, clock *fakeClock) (*inmem.DB, error)
+	}{
+		{
+			name: "should restore expiries from a snapshot",
+			reopen: func(t *testing.T, clock *fakeClock) (*inmem.DB, error) {
+				db := inmem.NewDB(ttlTables, inmem.WithClock(clock.Now))
+				defer db.Close()
+				if err := write(db, clock); err != nil {
+					return nil, err
+				}
+
+				var buf bytes.Buffer
+				if err := db.SaveSnapshot(&buf); err != nil {
+					return nil, err
+				}
+				return inmem.LoadSnapshot(&buf, inmem.WithClock(clock.Now))
+			},
+		},
+		{
+			name: "should restore expiries from the log",
+			reopen: func(t *testing.T, clock *fakeClock) (*inmem.DB, error) {
+				dir := t.TempDir()
+				db, err := inmem.Open(dir, ttlTables, inmem.WithClock(clock.Now))
+				if err != nil {
+					return nil, err
+				}
+				if err := write(db, clock); err != nil {
+					return nil, err
+				}
+				if err := db.Close(); err != nil {
+					return nil, err
+				}
+				return inmem.Open(dir, ttlTables, inmem.WithClock(clock.Now))
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			clock := newFakeClock()
+			db, err := tc.reopen(t, clock)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer db.Close()
+
+			ctx := context.Background()
+			got, err := db.Get(ctx, "imports", "csid", "cs1")
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{[]byte("import1")}, got)
+
+			// the table's TTL survives as well as the rows' expiries
+			clock.Advance(time.Second)
+			got, err = db.Get(ctx, "imports", "csid", "cs1")
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{}, got)
+
+			assert.Nil(t, db.Insert(ctx, "statuses", []string{"id", "csid"}, []string{"status2", "cs1"}, []byte("status2")))
+			clock.Advance(time.Minute)
+			got, err = db.Get(ctx, "statuses", "csid", "cs1")
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{}, got)
+		})
+	}
+}
+
+func TestDB_ExpirySweeper(t *testing.T) {
+
+	clock := newFakeClock()
+	// each background sweep reads the clock before it starts, and nothing else does once the row is written
+	var reads int64
+	now := func() time.Time {
+		atomic.AddInt64(&reads, 1)
+		return clock.Now()
+	}
+	db := inmem.NewDB(ttlTables, inmem.WithClock(now), inmem.WithSweepInterval(time.Millisecond))
+	defer db.Close()
+
+	ctx := context.Background()
+	if !assert.Nil(t, db.InsertWithExpiry(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1"), clock.Now().Add(time.Second))) {
+		return
+	}
+	clock.Advance(time.Second)
+
+	// once a second sweep has started the first is done, after which there is nothing left to sweep
+	start := atomic.LoadInt64(&reads)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&reads) >= start+2
+	}, time.Second, time.Millisecond)
+	swept, err := db.SweepExpired(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, swept)
+}
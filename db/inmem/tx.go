@@ -0,0 +1,984 @@
+package inmem
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Tx is a transaction started with DB.Begin. Writes made through a Tx are only visible to that Tx until Commit applies
+// all of them at once, and are discarded by Rollback. Reads through a Tx see the DB as it was when the Tx began, plus
+// the Tx's own writes. A Tx must not be used from more than one goroutine at a time
+// EXAMPLE:
+//
+//	tx, err := db.Begin(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer tx.Rollback()
+//
+//	if err := tx.Insert(ctx, "imports", []string{"id"}, []string{importID}, imp); err != nil {
+//		return err
+//	}
+//	if err := tx.Update(ctx, "profiles", "id", profileID, p); err != nil {
+//		return err
+//	}
+//
+//	return tx.Commit()
+type Tx struct {
+	db *DB
+	// ctx is the context the Tx began with. Commit gives up waiting for table locks once it is done
+	ctx   context.Context
+	views map[string]*view
+	// snap is the commit timestamp the transaction reads at
+	snap uint64
+	// held holds the tables the caller already has locked for the life of the Tx, as the DB's own writes do. Those
+	// transactions don't register their snapshot, since the table can't be collected while the lock is held
+	held map[*table]bool
+	done bool
+	// registered is set once snap is registered, so the Tx can let go of table locks between statements, or during
+	// long reads, without the versions it reads being collected
+	registered bool
+	// reading is set for the DB's own one statement reads. They take their snapshot once the table is locked, and only
+	// register it if a long read lets go of the lock
+	reading bool
+	// failed holds the error a statement failed with after its writes were recorded, such as an after hook's veto.
+	// Commit returns it rather than apply them
+	failed error
+	// evicted holds the rows evicted by the commit, for the DB's eviction callback
+	evicted []Evicted
+	// deliveries holds the changes made by the commit, for the watchers of the tables it wrote
+	deliveries []*delivery
+}
+
+// Begin starts a transaction reading at a snapshot of the latest commit. If ctx is done before the transaction
+// commits, Commit fails rather than wait for locks; each statement still takes its own context
+func (db *DB) Begin(ctx context.Context) (*Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tx := db.newTx(ctx)
+	tx.snap, tx.registered = db.snapshot(), true
+
+	return tx, nil
+}
+
+func (db *DB) newTx(ctx context.Context) *Tx {
+	return &Tx{
+		db:    db,
+		ctx:   ctx,
+		views: make(map[string]*view),
+		held:  make(map[*table]bool),
+	}
+}
+
+// Commit applies every write made in the transaction. If another transaction committed a change to any of the rows
+// written since this one began, or a write would break a unique constraint, nothing is applied and an error is
+// returned. If the context the transaction began with is done while waiting for locks, nothing is applied and its
+// error is returned. Once a hook has vetoed the transaction, Commit applies nothing and returns the hook's error
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	defer tx.end()
+
+	if tx.failed != nil {
+		tx.views = nil
+		return tx.failed
+	}
+	if err := tx.commit(); err != nil {
+		return err
+	}
+
+	tx.deliver()
+	tx.db.onEvicted(tx.evicted)
+	return nil
+}
+
+// Rollback discards every write made in the transaction. Rolling back a transaction that was already committed or
+// rolled back returns ErrTxDone
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.views = nil
+	tx.end()
+
+	return nil
+}
+
+// deliver sends the changes made by the commit to the watchers of the tables it wrote. The tables must be unlocked
+func (tx *Tx) deliver() {
+	for _, d := range tx.deliveries {
+		d.send(tx.db.closing)
+	}
+	tx.deliveries = nil
+}
+
+// end releases the transaction's snapshot, collecting any versions only it could see
+func (tx *Tx) end() {
+	if tx.registered && tx.db.release(tx.snap) {
+		tx.db.collect()
+	}
+}
+
+func (tx *Tx) commit() error {
+	names := make([]string, 0, len(tx.views))
+	for name, v := range tx.views {
+		if len(v.writes) > 0 {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	// lock in name order so two transactions writing the same tables can't deadlock
+	for _, name := range names {
+		if t := tx.views[name].t; !tx.held[t] {
+			if err := t.mu.lock(tx.ctx); err != nil {
+				return err
+			}
+			defer t.mu.unlock()
+		}
+	}
+
+	// validate every table before applying any of them, so a failed commit leaves nothing behind. Every table written
+	// is locked, so only commits to other tables can move the clock past latest before ours is applied
+	latest, now := atomic.LoadUint64(&tx.db.clock), tx.db.now()
+	for _, name := range names {
+		if err := tx.views[name].validate(latest, now); err != nil {
+			return err
+		}
+	}
+
+	ts := tx.db.issue()
+	var evicted []Evicted
+	watchers := make(map[string][]*watcher)
+	changes := make(map[string][]change)
+	for _, name := range names {
+		v := tx.views[name]
+		v.resolve()
+		evicted = append(evicted, v.evict()...)
+
+		watchers[name] = tx.db.watching(name)
+		changes[name] = v.changes(watchers[name])
+	}
+
+	// the commit is logged before it is applied, so it is only visible once it will survive a restart
+	if err := tx.db.logCommit(ts, names, tx.views); err != nil {
+		// later commits wait for ours to publish, even though there is nothing to apply
+		tx.db.publish(ts)
+		return err
+	}
+	tx.evicted = evicted
+
+	expiring := false
+	for _, name := range names {
+		expiring = tx.views[name].apply(ts) || expiring
+	}
+	tx.db.publish(ts)
+
+	if expiring {
+		tx.db.startSweeper()
+	}
+
+	// changes are queued while the tables are still locked, so watchers get each table's changes in commit order
+	for _, name := range names {
+		if len(changes[name]) > 0 {
+			tx.deliveries = append(tx.deliveries, tx.views[name].delivery(watchers[name], ts, changes[name]))
+		}
+	}
+
+	h := tx.db.horizon()
+	for _, name := range names {
+		tx.views[name].t.collect(h)
+	}
+
+	return nil
+}
+
+// Get ...
+func (tx *Tx) Get(ctx context.Context, table string, whereCol string, id string) ([][]byte, error) {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	v, unlock, err := tx.rview(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return v.query(ctx, eq{col: colName(whereCol), v: val(id)})
+}
+
+// GetByKey returns the data of the row in table whose primary key is key
+func (tx *Tx) GetByKey(ctx context.Context, table string, key string) ([]byte, error) {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	v, unlock, err := tx.rview(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return v.getByKey(ctx, val(key))
+}
+
+// Insert ...
+func (tx *Tx) Insert(ctx context.Context, table string, cols []string, vals []string, data []byte) error {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	if len(cols) != len(vals) {
+		return &Error{Err: ErrArityMismatch, Table: table}
+	}
+
+	v, unlock, err := tx.wview(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return v.insert(ctx, row{
+		cols: cols,
+		vals: vals,
+		data: data,
+	})
+}
+
+// InsertWithExpiry inserts a row into table that expires at expires. See DB.InsertWithExpiry
+func (tx *Tx) InsertWithExpiry(ctx context.Context, table string, cols []string, vals []string, data []byte, expires time.Time) error {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	if len(cols) != len(vals) {
+		return &Error{Err: ErrArityMismatch, Table: table}
+	}
+
+	v, unlock, err := tx.wview(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return v.insert(ctx, row{
+		cols:    cols,
+		vals:    vals,
+		data:    data,
+		expires: expires,
+	})
+}
+
+// Upsert inserts a row into table, or replaces the row with the same primary key if there is one. See DB.Upsert
+func (tx *Tx) Upsert(ctx context.Context, table string, cols []string, vals []string, data []byte) error {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	if len(cols) != len(vals) {
+		return &Error{Err: ErrArityMismatch, Table: table}
+	}
+
+	v, unlock, err := tx.wview(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if v.t.pk == "" {
+		return &Error{Err: ErrNoPrimaryKey, Table: table}
+	}
+
+	return v.upsert(ctx, row{
+		cols: cols,
+		vals: vals,
+		data: data,
+	})
+}
+
+// Update ...
+func (tx *Tx) Update(ctx context.Context, table string, col string, val string, data []byte) error {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	if col == "" || val == "" {
+		return &Error{Err: ErrMissingArgument, Table: table}
+	}
+
+	v, unlock, err := tx.wview(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return v.update(ctx, col, val, data, nil)
+}
+
+// UpdateWithExpiry replaces the data of every row in table where col equals val and makes them expire at expires.
+// See DB.UpdateWithExpiry
+func (tx *Tx) UpdateWithExpiry(ctx context.Context, table string, col string, val string, data []byte, expires time.Time) error {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	if col == "" || val == "" {
+		return &Error{Err: ErrMissingArgument, Table: table}
+	}
+
+	v, unlock, err := tx.wview(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return v.update(ctx, col, val, data, &expires)
+}
+
+// UpdateRow replaces the data and sets cols to vals on every row in table where whereCol equals id. See DB.UpdateRow
+func (tx *Tx) UpdateRow(ctx context.Context, table string, whereCol string, id string, cols []string, vals []string, data []byte) error {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	if whereCol == "" || id == "" {
+		return &Error{Err: ErrMissingArgument, Table: table}
+	}
+
+	if len(cols) != len(vals) {
+		return &Error{Err: ErrArityMismatch, Table: table}
+	}
+
+	v, unlock, err := tx.wview(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return v.updateRow(ctx, whereCol, id, row{
+		cols: cols,
+		vals: vals,
+		data: data,
+	})
+}
+
+// Delete removes every row in table where whereCol equals id. See DB.Delete
+func (tx *Tx) Delete(ctx context.Context, table string, whereCol string, id string) error {
+	ctx, cancel := tx.db.callContext(ctx)
+	defer cancel()
+
+	if whereCol == "" || id == "" {
+		return &Error{Err: ErrMissingArgument, Table: table}
+	}
+
+	v, unlock, err := tx.wview(ctx, table)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return v.delete(ctx, whereCol, id)
+}
+
+// view returns the transaction's view of table
+func (tx *Tx) view(table string) (*view, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	if v, found := tx.views[table]; found {
+		return v, nil
+	}
+
+	tbl := tx.db.lookup(table)
+	if tbl == nil {
+		return nil, &Error{Err: ErrTableNotFound, Table: table}
+	}
+
+	v := newView(tbl, tx.snap)
+	v.tx = tx
+	tx.views[table] = v
+
+	return v, nil
+}
+
+// rview returns the transaction's view of table with the table read locked, and the func to release the lock. It
+// fails with ctx.Err() if ctx is done before the lock is acquired
+func (tx *Tx) rview(ctx context.Context, table string) (*view, func(), error) {
+	v, err := tx.view(table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unlock := func() {}
+	if !tx.held[v.t] {
+		if err := v.t.mu.rlock(ctx); err != nil {
+			return nil, nil, err
+		}
+		v.rlocked = true
+		unlock = func() {
+			// pause may have failed to take the lock back
+			if v.rlocked {
+				v.rlocked = false
+				v.t.mu.runlock()
+			}
+			if v.detached {
+				v.detached = false
+				atomic.AddInt32(&v.t.detached, -1)
+			}
+		}
+	}
+
+	if v.t.dropped {
+		unlock()
+		return nil, nil, &Error{Err: ErrTableNotFound, Table: table}
+	}
+
+	if tx.reading && !tx.registered {
+		// nothing can be collected from under the snapshot while the lock is held
+		tx.snap = atomic.LoadUint64(&tx.db.clock)
+		v.snap = tx.snap
+	}
+
+	v.now = tx.db.now()
+	return v, unlock, nil
+}
+
+// wview returns the transaction's view of table with the table write locked, and the func to release the lock. It
+// fails with ctx.Err() if ctx is done before the lock is acquired
+func (tx *Tx) wview(ctx context.Context, table string) (*view, func(), error) {
+	v, err := tx.view(table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unlock := func() {}
+	if !tx.held[v.t] {
+		if err := v.t.mu.lock(ctx); err != nil {
+			return nil, nil, err
+		}
+		v.wlocked = true
+		unlock = func() {
+			// hooks let go of the lock while they run, and may have failed to take it back
+			if v.wlocked {
+				v.wlocked = false
+				v.t.mu.unlock()
+			}
+		}
+	}
+
+	if v.t.dropped {
+		unlock()
+		return nil, nil, &Error{Err: ErrTableNotFound, Table: table}
+	}
+
+	v.now = tx.db.now()
+	return v, unlock, nil
+}
+
+// scanCheckInterval is how many rows a scan visits between checks of its context
+const scanCheckInterval = 256
+
+// pendingRowID is the first ID handed to rows inserted in a transaction. They get their real IDs when the transaction
+// commits; until then IDs from here up keep them sorted after every committed row, in the order they were inserted
+const pendingRowID rowID = 1 << 63
+
+// view is a table as one transaction sees it: the rows visible at its snapshot overlaid with its own writes
+type view struct {
+	t    *table
+	snap uint64
+	// tx is the transaction the view belongs to, which the table's hooks are passed
+	tx *Tx
+	// writes holds the new version of every row the transaction wrote, nil for rows it deleted
+	writes map[rowID]*version
+	// base holds the committed rows the transaction wrote, so Commit can check nobody else changed them since the
+	// snapshot
+	base map[rowID]bool
+	// cols holds the columns the transaction wrote that the table doesn't have yet. They are only added to the table
+	// when it commits
+	cols   map[colName]bool
+	nextID rowID
+	// now is the time the statement using the view started, which rows are checked for expiry against
+	now time.Time
+	// rlocked is set while the statement using the view holds the table's read lock itself, which pause can let go of
+	rlocked bool
+	// wlocked is set while the statement using the view holds the table's write lock itself, which is let go of while
+	// hooks run
+	wlocked bool
+	// pauses counts the times the read lock was let go of, so walks of an ordered index know to find their place again
+	pauses int
+	// detached is set once the statement first lets go of the read lock, and counted in the table's detached until the
+	// statement is done
+	detached bool
+}
+
+func newView(t *table, snap uint64) *view {
+	return &view{
+		t:      t,
+		snap:   snap,
+		writes: make(map[rowID]*version),
+		base:   make(map[rowID]bool),
+		cols:   make(map[colName]bool),
+		nextID: pendingRowID,
+	}
+}
+
+// lookup returns row rid as the transaction sees it. Expired rows aren't seen
+func (v *view) lookup(rid rowID) (*version, bool) {
+	ver, found := v.writes[rid]
+	if !found {
+		ver = v.t.visible(rid, v.snap)
+	}
+
+	if ver == nil || ver.expired(v.now) {
+		return nil, false
+	}
+	return ver, true
+}
+
+// eval returns the IDs of the rows matching where as the transaction sees them, sorted ascending. The indexes only
+// narrow down the candidates; each candidate is then matched against the version the transaction sees. Long scans
+// stop with ctx.Err() once ctx is done
+func (v *view) eval(ctx context.Context, where Predicate) ([]rowID, error) {
+	rowIDs, _, err := v.evalPage(ctx, where, 0, 0, 0)
+	return rowIDs, err
+}
+
+// candidates returns the IDs of the rows that may match where as the transaction sees them, sorted ascending: those
+// the indexes return, along with every row the transaction wrote. The slice may be shared with the table's indexes
+func (v *view) candidates(ctx context.Context, where Predicate) ([]rowID, error) {
+	candidates, err := where.eval(ctx, v)
+	if e := (*Error)(nil); errors.As(err, &e) && errors.Is(e.Err, ErrColumnNotFound) && v.cols[colName(e.Column)] {
+		// only the transaction's own rows hold the column, but where may still match rows without it
+		candidates, err = v.rowIDs(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(v.writes) > 0 {
+		candidates = union(candidates, sortedRowIDs(v.writes))
+	}
+	return candidates, nil
+}
+
+// pausable reports whether pause can let go of the table's lock: the statement must hold the read lock itself, and the
+// snapshot must be registered so nothing it reads is collected meanwhile, which pause does for the DB's own reads
+func (v *view) pausable() bool {
+	return v.rlocked && (v.tx.registered || v.tx.reading)
+}
+
+// pause is called between batches of a long read. If a writer is waiting for the table it lets go of the read lock
+// and takes it back, so the writer can go first. Row data and the index maps may change meanwhile, but the versions
+// visible at the snapshot stay put, and index buckets are copied on write until the statement is done, so slices of
+// them stay valid. Walks of an ordered index find their place again if pauses moved on. It fails with ctx.Err() once
+// ctx is done
+func (v *view) pause(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !v.pausable() || !v.t.mu.contended() {
+		return nil
+	}
+
+	return v.readUnlocked(ctx, func() {})
+}
+
+// readUnlocked runs fn with the statement's read lock on the table let go of, taking it back once fn is done, for work
+// on the statement's own data that can take a while. fn runs with the lock held if the view isn't pausable
+func (v *view) readUnlocked(ctx context.Context, fn func()) error {
+	if !v.pausable() {
+		fn()
+		return nil
+	}
+
+	if !v.tx.registered {
+		v.tx.db.hold(v.tx.snap)
+		v.tx.registered = true
+	}
+	if !v.detached {
+		// the statement may hold slices of the buckets until it is done, so writers copy them rather than change them
+		v.detached = true
+		atomic.AddInt32(&v.t.detached, 1)
+	}
+	v.rlocked = false
+	v.t.mu.runlock()
+	fn()
+	if err := v.t.mu.rlock(ctx); err != nil {
+		return err
+	}
+	v.rlocked = true
+	v.pauses++
+
+	if v.t.dropped {
+		return &Error{Err: ErrTableNotFound, Table: v.t.name}
+	}
+	return nil
+}
+
+// sortRowIDs sorts rowIDs ascending, letting go of the read lock meanwhile if there are enough of them to keep a
+// writer waiting
+func (v *view) sortRowIDs(ctx context.Context, rowIDs []rowID) error {
+	sortIDs := func() { sort.Slice(rowIDs, func(i, j int) bool { return rowIDs[i] < rowIDs[j] }) }
+	if len(rowIDs) < scanCheckInterval {
+		sortIDs()
+		return nil
+	}
+
+	return v.readUnlocked(ctx, sortIDs)
+}
+
+// next returns the node after n in the ordered index sl, for a walk that reached n when v.pauses was at pauses. If the
+// lock was let go of since, n may have been removed, so the walk finds its place again by value
+func (v *view) next(sl *skiplist, n *node, pauses int) *node {
+	if v.pauses == pauses {
+		return n.next[0]
+	}
+
+	next := sl.seek(n.v)
+	if next != nil && next.v == n.v {
+		next = next.next[0]
+	}
+	return next
+}
+
+// rowIDs returns the ID of every row in the table, sorted ascending, pausing as it goes
+func (v *view) rowIDs(ctx context.Context) ([]rowID, error) {
+	rowIDs := make([]rowID, 0, len(v.t.rowData))
+	for rid := range v.t.rowData {
+		if len(rowIDs)%scanCheckInterval == 0 && len(rowIDs) > 0 {
+			if err := v.pause(ctx); err != nil {
+				return nil, err
+			}
+		}
+		rowIDs = append(rowIDs, rid)
+	}
+
+	return rowIDs, v.sortRowIDs(ctx, rowIDs)
+}
+
+// evalPage is eval limited to a page of the matching rows: those from rowID from on, past the first offset of them
+// and at most limit, if limit is above zero. It also reports whether more rows match past the page
+func (v *view) evalPage(ctx context.Context, where Predicate, from rowID, offset, limit int) ([]rowID, bool, error) {
+	if where == nil {
+		where = And()
+	}
+
+	candidates, err := v.candidates(ctx, where)
+	if err != nil {
+		return nil, false, err
+	}
+	candidates = candidates[sort.Search(len(candidates), func(i int) bool { return candidates[i] >= from }):]
+
+	n := len(candidates)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+
+	rowIDs := make([]rowID, 0, n)
+	for i, rid := range candidates {
+		if i%scanCheckInterval == 0 && i > 0 {
+			if err := v.pause(ctx); err != nil {
+				return nil, false, err
+			}
+		}
+
+		if ver, found := v.lookup(rid); !found || !where.match(ver.vals) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit > 0 && len(rowIDs) == limit {
+			return rowIDs, true, nil
+		}
+		rowIDs = append(rowIDs, rid)
+	}
+
+	return rowIDs, false, nil
+}
+
+func (v *view) query(ctx context.Context, where Predicate) ([][]byte, error) {
+	rowIDs, err := v.eval(ctx, where)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.data(ctx, rowIDs)
+}
+
+// data returns the data of rows rowIDs, which must all be visible to the transaction, recording that they were read
+func (v *view) data(ctx context.Context, rowIDs []rowID) ([][]byte, error) {
+	toReturn := make([][]byte, len(rowIDs))
+	for i, rid := range rowIDs {
+		if i%scanCheckInterval == 0 && i > 0 {
+			if err := v.pause(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		ver, _ := v.lookup(rid)
+		toReturn[i] = ver.data
+	}
+	v.access(rowIDs)
+
+	return toReturn, nil
+}
+
+// find returns the IDs of the rows where c equals val, failing if there are none
+func (v *view) find(ctx context.Context, c, id string) ([]rowID, error) {
+	rowIDs, err := v.eval(ctx, eq{col: colName(c), v: val(id)})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rowIDs) == 0 {
+		return nil, &Error{Err: ErrValueNotFound, Table: v.t.name, Column: c, Value: id}
+	}
+
+	return rowIDs, nil
+}
+
+func (v *view) getByKey(ctx context.Context, key val) ([]byte, error) {
+	if v.t.pk == "" {
+		return nil, &Error{Err: ErrNoPrimaryKey, Table: v.t.name}
+	}
+
+	rowIDs, err := v.eval(ctx, eq{col: v.t.pk, v: key})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rowIDs) == 0 {
+		return nil, &Error{Err: ErrValueNotFound, Table: v.t.name, Column: string(v.t.pk), Value: string(key)}
+	}
+
+	ver, _ := v.lookup(rowIDs[0])
+	v.access(rowIDs[:1])
+	return ver.data, nil
+}
+
+func (v *view) insert(ctx context.Context, r row) error {
+	if err := v.t.checkColumns(r.cols); err != nil {
+		return err
+	}
+
+	rid := v.nextID
+	ver := r.version()
+	v.expire(ver)
+	if err := v.checkUnique(ctx, map[rowID]*version{rid: ver}); err != nil {
+		return err
+	}
+
+	v.nextID++
+	return v.put(ctx, r.cols, map[rowID]*version{rid: ver})
+}
+
+func (v *view) upsert(ctx context.Context, r row) error {
+	key, found := r.val(v.t.pk)
+	if !found {
+		return &Error{Err: ErrMissingArgument, Table: v.t.name, Column: string(v.t.pk)}
+	}
+
+	rowIDs, err := v.eval(ctx, eq{col: v.t.pk, v: key})
+	if err != nil {
+		return err
+	}
+
+	if len(rowIDs) == 0 {
+		return v.insert(ctx, r)
+	}
+
+	if err := v.t.checkColumns(r.cols); err != nil {
+		return err
+	}
+
+	ver := r.version()
+	v.expire(ver)
+	replaced := map[rowID]*version{rowIDs[0]: ver}
+	if err := v.checkUnique(ctx, replaced); err != nil {
+		return err
+	}
+
+	return v.put(ctx, r.cols, replaced)
+}
+
+// update replaces the data of the rows where c equals id. The rows keep their expiry unless expires is set
+func (v *view) update(ctx context.Context, c, id string, d []byte, expires *time.Time) error {
+	rowIDs, err := v.find(ctx, c, id)
+	if err != nil {
+		return err
+	}
+
+	updated := make(map[rowID]*version, len(rowIDs))
+	for _, rid := range rowIDs {
+		ver, _ := v.lookup(rid)
+		updated[rid] = &version{vals: ver.vals, data: d, expires: ver.expires}
+		if expires != nil {
+			updated[rid].expires = *expires
+		}
+	}
+
+	return v.put(ctx, nil, updated)
+}
+
+func (v *view) updateRow(ctx context.Context, c, id string, r row) error {
+	rowIDs, err := v.find(ctx, c, id)
+	if err != nil {
+		return err
+	}
+
+	if err := v.t.checkColumns(r.cols); err != nil {
+		return err
+	}
+
+	updated := make(map[rowID]*version, len(rowIDs))
+	for _, rid := range rowIDs {
+		ver, _ := v.lookup(rid)
+
+		vals := make(map[colName]val, len(ver.vals)+len(r.cols))
+		for cn, cv := range ver.vals {
+			vals[cn] = cv
+		}
+		for i, cn := range r.cols {
+			vals[colName(cn)] = val(r.vals[i])
+		}
+
+		updated[rid] = &version{vals: vals, data: r.data, expires: ver.expires}
+	}
+
+	if err := v.checkUnique(ctx, updated); err != nil {
+		return err
+	}
+
+	return v.put(ctx, r.cols, updated)
+}
+
+func (v *view) delete(ctx context.Context, c, id string) error {
+	rowIDs, err := v.find(ctx, c, id)
+	if err != nil {
+		return err
+	}
+
+	deleted := make(map[rowID]*version, len(rowIDs))
+	for _, rid := range rowIDs {
+		deleted[rid] = nil
+	}
+
+	return v.put(ctx, nil, deleted)
+}
+
+// checkUnique returns an error if writing rows would leave two rows with the same value in a unique column, as the
+// transaction sees the table
+func (v *view) checkUnique(ctx context.Context, rows map[rowID]*version) error {
+	return v.t.checkUnique(rows, func(c colName, cv val) ([]rowID, error) {
+		return v.eval(ctx, eq{col: c, v: cv})
+	})
+}
+
+// write records rows as written by the transaction. Columns in cols that the table hasn't seen yet are kept by the view
+// until it commits, so the transaction can query its own rows by them
+func (v *view) write(cols []string, rows map[rowID]*version) {
+	for _, c := range cols {
+		if _, found := v.t.rows[colName(c)]; !found {
+			v.cols[colName(c)] = true
+		}
+	}
+
+	for rid, ver := range rows {
+		if rid >= pendingRowID {
+			if ver == nil {
+				// the row was inserted by this transaction, so deleting it leaves nothing to commit
+				delete(v.writes, rid)
+				continue
+			}
+		} else {
+			v.base[rid] = true
+		}
+
+		v.writes[rid] = ver
+	}
+}
+
+// column returns the index for column c, which is empty for a column only the transaction has written so far
+func (v *view) column(c colName) (map[val][]rowID, error) {
+	if v.cols[c] {
+		if _, found := v.t.rows[c]; !found {
+			return nil, nil
+		}
+	}
+	return v.t.column(c)
+}
+
+// validate returns an error if the transaction's writes can't be applied to the table as of the latest commit: when
+// another transaction committed a new version of a row it wrote after its snapshot, or when a write breaks a unique
+// constraint against the latest committed rows that haven't expired by now
+func (v *view) validate(latest uint64, now time.Time) error {
+	if v.t.dropped {
+		return &Error{Err: ErrTableNotFound, Table: v.t.name}
+	}
+
+	for rid := range v.base {
+		rec, found := v.t.rowData[rid]
+		if !found || rec.versions.ts > v.snap {
+			return &Error{Err: ErrConflict, Table: v.t.name}
+		}
+	}
+
+	return v.t.checkUnique(v.writes, func(c colName, cv val) ([]rowID, error) {
+		holders := make([]rowID, 0)
+		for _, rid := range v.t.rows[c][cv] {
+			if ver := v.t.visible(rid, latest); ver != nil && !ver.expired(now) && ver.vals[c] == cv {
+				holders = append(holders, rid)
+			}
+		}
+		return holders, nil
+	})
+}
+
+// apply installs the transaction's writes as versions stamped with commit timestamp ts, reporting whether any of them
+// expire. The writes must have been resolved
+func (v *view) apply(ts uint64) bool {
+	for c := range v.cols {
+		v.t.addColumns([]string{string(c)})
+	}
+
+	expiring := false
+	for _, rid := range sortedRowIDs(v.writes) {
+		ver := v.writes[rid]
+		v.t.install(rid, ver, ts)
+		expiring = expiring || ver != nil && !ver.expires.IsZero()
+	}
+	return expiring
+}
+
+// resolve readies the transaction's writes to be logged and applied: rows inserted by the transaction get their real
+// IDs, in the order they were inserted, and values for columns dropped since the rows were written are left out
+func (v *view) resolve() {
+	writes := make(map[rowID]*version, len(v.writes))
+	for _, rid := range sortedRowIDs(v.writes) {
+		ver := v.writes[rid]
+		if rid >= pendingRowID {
+			rid = v.t.nextID
+			v.t.nextID++
+		}
+
+		if ver != nil {
+			for c := range ver.vals {
+				if _, found := v.t.rows[c]; !found && !v.cols[c] {
+					ver.vals = without(ver.vals, c)
+				}
+			}
+		}
+
+		writes[rid] = ver
+	}
+
+	v.writes = writes
+}
@@ -0,0 +1,429 @@
+package inmem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTx_Commit(t *testing.T) {
+
+	type get struct {
+		table string
+		col   string
+		id    string
+		want  [][]byte
+	}
+
+	testCases := []struct {
+		name string
+		// setup runs against the DB before the transaction starts
+		setup func(db *inmem.DB)
+		// tx runs inside the transaction
+		tx func(tx *inmem.Tx) error
+		// concurrent runs against the DB after tx but before Commit
+		concurrent    func(db *inmem.DB)
+		rollback      bool
+		wantTxErr     error
+		wantCommitErr error
+		// wantGets run against the DB after Commit or Rollback
+		wantGets []get
+	}{
+		{
+			name: "should apply writes to several tables on commit",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1"))
+			},
+			tx: func(tx *inmem.Tx) error {
+				if err := tx.Insert(context.Background(), "imports", []string{"id", "user"}, []string{"import1", "user1"}, []byte("import1")); err != nil {
+					return err
+				}
+				return tx.Update(context.Background(), "profiles", "id", "user1", []byte("profile1-imported"))
+			},
+			wantGets: []get{
+				{table: "imports", col: "user", id: "user1", want: [][]byte{[]byte("import1")}},
+				{table: "profiles", col: "id", id: "user1", want: [][]byte{[]byte("profile1-imported")}},
+			},
+		},
+		{
+			name: "should discard writes on rollback",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1"))
+			},
+			tx: func(tx *inmem.Tx) error {
+				if err := tx.Insert(context.Background(), "imports", []string{"id", "user"}, []string{"import1", "user1"}, []byte("import1")); err != nil {
+					return err
+				}
+				return tx.Delete(context.Background(), "profiles", "id", "user1")
+			},
+			rollback: true,
+			wantGets: []get{
+				{table: "imports", col: "user", id: "user1", want: [][]byte{}},
+				{table: "profiles", col: "id", id: "user1", want: [][]byte{[]byte("profile1")}},
+			},
+		},
+		{
+			name: "should order rows inserted by the transaction after committed rows",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"csid"}, []string{"cs1"}, []byte("import1"))
+			},
+			tx: func(tx *inmem.Tx) error {
+				if err := tx.Insert(context.Background(), "imports", []string{"csid"}, []string{"cs1"}, []byte("import2")); err != nil {
+					return err
+				}
+				return tx.Insert(context.Background(), "imports", []string{"csid"}, []string{"cs1"}, []byte("import3"))
+			},
+			concurrent: func(db *inmem.DB) {
+				db.Insert(context.Background(), "imports", []string{"csid"}, []string{"cs1"}, []byte("import4"))
+			},
+			wantGets: []get{
+				{table: "imports", col: "csid", id: "cs1", want: [][]byte{[]byte("import1"), []byte("import4"), []byte("import2"), []byte("import3")}},
+			},
+		},
+		{
+			name: "should not commit a row inserted and deleted in the transaction",
+			tx: func(tx *inmem.Tx) error {
+				if err := tx.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")); err != nil {
+					return err
+				}
+				if err := tx.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, []byte("import2")); err != nil {
+					return err
+				}
+				return tx.Delete(context.Background(), "imports", "id", "import1")
+			},
+			wantGets: []get{
+				{table: "imports", col: "csid", id: "cs1", want: [][]byte{[]byte("import2")}},
+			},
+		},
+		{
+			name: "should fail to commit a row changed by another writer",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1"))
+			},
+			tx: func(tx *inmem.Tx) error {
+				if err := tx.Insert(context.Background(), "imports", []string{"id", "user"}, []string{"import1", "user1"}, []byte("import1")); err != nil {
+					return err
+				}
+				return tx.Update(context.Background(), "profiles", "id", "user1", []byte("profile1-tx"))
+			},
+			concurrent: func(db *inmem.DB) {
+				db.Update(context.Background(), "profiles", "id", "user1", []byte("profile1-concurrent"))
+			},
+			wantCommitErr: &inmem.Error{Err: inmem.ErrConflict, Table: "profiles"},
+			wantGets: []get{
+				{table: "imports", col: "user", id: "user1", want: [][]byte{}},
+				{table: "profiles", col: "id", id: "user1", want: [][]byte{[]byte("profile1-concurrent")}},
+			},
+		},
+		{
+			name: "should fail to commit a row deleted by another writer",
+			setup: func(db *inmem.DB) {
+				db.Insert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1"))
+			},
+			tx: func(tx *inmem.Tx) error {
+				return tx.UpdateRow(context.Background(), "profiles", "id", "user1", []string{"name"}, []string{"name1"}, []byte("profile1-tx"))
+			},
+			concurrent: func(db *inmem.DB) {
+				db.Delete(context.Background(), "profiles", "id", "user1")
+			},
+			wantCommitErr: &inmem.Error{Err: inmem.ErrConflict, Table: "profiles"},
+			wantGets: []get{
+				{table: "profiles", col: "id", id: "user1", want: [][]byte{}},
+			},
+		},
+		{
+			name: "should fail to commit a duplicate inserted by another writer",
+			tx: func(tx *inmem.Tx) error {
+				return tx.Insert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1-tx"))
+			},
+			concurrent: func(db *inmem.DB) {
+				db.Insert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1-concurrent"))
+			},
+			wantCommitErr: &inmem.Error{Err: inmem.ErrUniqueViolation, Table: "profiles", Column: "id", Value: "user1"},
+			wantGets: []get{
+				{table: "profiles", col: "id", id: "user1", want: [][]byte{[]byte("profile1-concurrent")}},
+			},
+		},
+		{
+			name: "should reject a duplicate of a row inserted earlier in the transaction",
+			tx: func(tx *inmem.Tx) error {
+				if err := tx.Insert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1")); err != nil {
+					return err
+				}
+				return tx.Insert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1-again"))
+			},
+			wantTxErr: &inmem.Error{Err: inmem.ErrUniqueViolation, Table: "profiles", Column: "id", Value: "user1"},
+			wantGets: []get{
+				{table: "profiles", col: "id", id: "user1", want: [][]byte{[]byte("profile1")}},
+			},
+		},
+		{
+			name: "should fail due to table not existing",
+			tx: func(tx *inmem.Tx) error {
+				return tx.Insert(context.Background(), "winky wonky", []string{"id"}, []string{"user1"}, []byte("profile1"))
+			},
+			wantTxErr: &inmem.Error{Err: inmem.ErrTableNotFound, Table: "winky wonky"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{
+				{
+					Name:    "imports",
+					Columns: []string{"id", "user", "csid"},
+				},
+				{
+					Name:       "profiles",
+					PrimaryKey: "id",
+				},
+			})
+
+			if tc.setup != nil {
+				tc.setup(db)
+			}
+
+			tx, err := db.Begin(context.Background())
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			gotTxErr := tc.tx(tx)
+			if tc.wantTxErr != nil {
+				assert.Equal(t, tc.wantTxErr, gotTxErr)
+			} else if !assert.Nil(t, gotTxErr) {
+				return
+			}
+
+			if tc.concurrent != nil {
+				tc.concurrent(db)
+			}
+
+			if tc.rollback {
+				assert.Nil(t, tx.Rollback())
+			} else {
+				assert.Equal(t, tc.wantCommitErr, tx.Commit())
+			}
+
+			for _, g := range tc.wantGets {
+				got, err := db.Get(context.Background(), g.table, g.col, g.id)
+				if !assert.Nil(t, err) {
+					return
+				}
+				assert.Equal(t, g.want, got)
+			}
+		})
+	}
+}
+
+func TestTx_Reads(t *testing.T) {
+
+	testCases := []struct {
+		name string
+		// tx runs inside the transaction before the reads
+		tx func(tx *inmem.Tx) error
+		// read runs inside the transaction, wantTx is what it should return there and wantDB is what the same read
+		// should return on the DB before Commit
+		read   func(r reader) ([][]byte, error)
+		wantTx [][]byte
+		wantDB [][]byte
+	}{
+		{
+			name: "should see its own inserts",
+			tx: func(tx *inmem.Tx) error {
+				return tx.Insert(context.Background(), "imports", []string{"id", "status"}, []string{"import3", "failed"}, []byte("import3"))
+			},
+			read:   getRows("imports", "status", "failed"),
+			wantTx: [][]byte{[]byte("import1"), []byte("import3")},
+			wantDB: [][]byte{[]byte("import1")},
+		},
+		{
+			name: "should see its own deletes",
+			tx: func(tx *inmem.Tx) error {
+				return tx.Delete(context.Background(), "imports", "id", "import1")
+			},
+			read:   getRows("imports", "status", "failed"),
+			wantTx: [][]byte{},
+			wantDB: [][]byte{[]byte("import1")},
+		},
+		{
+			name: "should see rows moved between index buckets",
+			tx: func(tx *inmem.Tx) error {
+				return tx.UpdateRow(context.Background(), "imports", "id", "import2", []string{"status"}, []string{"failed"}, []byte("import2-failed"))
+			},
+			read:   getRows("imports", "status", "failed"),
+			wantTx: [][]byte{[]byte("import1"), []byte("import2-failed")},
+			wantDB: [][]byte{[]byte("import1")},
+		},
+		{
+			name: "should match its own writes against predicates",
+			tx: func(tx *inmem.Tx) error {
+				if err := tx.Insert(context.Background(), "imports", []string{"id", "status"}, []string{"import3", "processing"}, []byte("import3")); err != nil {
+					return err
+				}
+				return tx.Update(context.Background(), "imports", "id", "import2", []byte("import2-updated"))
+			},
+			read: func(r reader) ([][]byte, error) {
+				return r.Query(context.Background(), "imports", inmem.Not(inmem.Eq("status", "failed")))
+			},
+			wantTx: [][]byte{[]byte("import2-updated"), []byte("import3")},
+			wantDB: [][]byte{[]byte("import2")},
+		},
+		{
+			name: "should see its own upserts by key",
+			tx: func(tx *inmem.Tx) error {
+				return tx.Upsert(context.Background(), "imports", []string{"id", "status"}, []string{"import1", "succeeded"}, []byte("import1-retried"))
+			},
+			read: func(r reader) ([][]byte, error) {
+				d, err := r.GetByKey(context.Background(), "imports", "import1")
+				return [][]byte{d}, err
+			},
+			wantTx: [][]byte{[]byte("import1-retried")},
+			wantDB: [][]byte{[]byte("import1")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB([]inmem.Table{
+				{
+					Name:       "imports",
+					Columns:    []string{"status"},
+					PrimaryKey: "id",
+				},
+			})
+			db.Insert(context.Background(), "imports", []string{"id", "status"}, []string{"import1", "failed"}, []byte("import1"))
+			db.Insert(context.Background(), "imports", []string{"id", "status"}, []string{"import2", "succeeded"}, []byte("import2"))
+
+			tx, err := db.Begin(context.Background())
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer tx.Rollback()
+
+			if !assert.Nil(t, tc.tx(tx)) {
+				return
+			}
+
+			gotTx, err := tc.read(tx)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.wantTx, gotTx)
+
+			gotDB, err := tc.read(db)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.wantDB, gotDB)
+
+			if !assert.Nil(t, tx.Commit()) {
+				return
+			}
+
+			gotDB, err = tc.read(db)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tc.wantTx, gotDB)
+		})
+	}
+}
+
+func TestTx_NewColumns(t *testing.T) {
+
+	ctx := context.Background()
+	notFound := &inmem.Error{Err: inmem.ErrColumnNotFound, Table: "imports", Column: "status"}
+
+	testCases := []struct {
+		name string
+		// end ends the transaction that wrote the new column
+		end     func(tx *inmem.Tx) error
+		want    [][]byte
+		wantErr error
+	}{
+		{
+			name:    "should drop columns a transaction created when it rolls back",
+			end:     func(tx *inmem.Tx) error { return tx.Rollback() },
+			wantErr: notFound,
+		},
+		{
+			name: "should add columns a transaction created when it commits",
+			end:  func(tx *inmem.Tx) error { return tx.Commit() },
+			want: [][]byte{[]byte("import1")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB(walTables)
+
+			tx, err := db.Begin(ctx)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer tx.Rollback()
+
+			if !assert.Nil(t, tx.Insert(ctx, "imports", []string{"id", "status"}, []string{"import1", "failed"}, []byte("import1"))) {
+				return
+			}
+
+			got, err := tx.Get(ctx, "imports", "status", "failed")
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{[]byte("import1")}, got)
+
+			got, err = tx.Query(ctx, "imports", inmem.Not(inmem.Eq("status", "done")))
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{[]byte("import1")}, got)
+
+			// the column isn't part of the table until the transaction commits
+			_, err = db.Get(ctx, "imports", "status", "failed")
+			assert.Equal(t, notFound, err)
+
+			if !assert.Nil(t, tc.end(tx)) {
+				return
+			}
+
+			got, err = db.Get(ctx, "imports", "status", "failed")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestTx_Done(t *testing.T) {
+
+	db := inmem.NewDB([]inmem.Table{
+		{
+			Name: "imports",
+		},
+	})
+
+	tx, err := db.Begin(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Nil(t, tx.Commit())
+	assert.Equal(t, inmem.ErrTxDone, tx.Commit())
+	assert.Equal(t, inmem.ErrTxDone, tx.Rollback())
+	assert.Equal(t, inmem.ErrTxDone, tx.Insert(context.Background(), "imports", []string{"id"}, []string{"import1"}, []byte("import1")))
+
+	_, err = tx.Get(context.Background(), "imports", "id", "import1")
+	assert.Equal(t, inmem.ErrTxDone, err)
+}
+
+// reader is the read surface shared by DB and Tx
+type reader interface {
+	Get(ctx context.Context, table string, whereCol string, id string) ([][]byte, error)
+	GetByKey(ctx context.Context, table string, key string) ([]byte, error)
+	Query(ctx context.Context, table string, where inmem.Predicate) ([][]byte, error)
+}
+
+func getRows(table string, col string, id string) func(r reader) ([][]byte, error) {
+	return func(r reader) ([][]byte, error) {
+		return r.Get(context.Background(), table, col, id)
+	}
+}
@@ -0,0 +1,607 @@
+package inmem
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Open returns a DB persisted to a write-ahead log in dir, creating dir if it doesn't exist. Every commit and schema
+// change is appended to the log and synced to disk before it is applied, so once a write returns it survives the
+// process exiting. Open replays the log to rebuild the DB as it was; a record cut short or corrupted by a crash part way
+// through writing it is cut off the end of the log, since it was never applied.
+//
+// tables are created if they don't exist yet, so the first Open creates them; after that they are restored from the
+// log, including any schema changes made since. Call Close once done with the DB
+func Open(dir string, tables []Table, opts ...Option) (*DB, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	db := NewDB(nil, opts...)
+	w, err := db.recover(dir)
+	if err != nil {
+		return nil, err
+	}
+	db.wal = w
+
+	for _, tbl := range tables {
+		if db.lookup(tbl.Name) != nil {
+			continue
+		}
+		if err := db.CreateTable(context.Background(), tbl); err != nil {
+			w.close()
+			return nil, err
+		}
+	}
+
+	db.startCheckpoints()
+	return db, nil
+}
+
+// Close stops the DB's background checkpoints and sweeping, and closes its log. Writes to a DB opened with Open fail
+// with ErrClosed once it is closed, while reads carry on working. Close returns the first error a background
+// checkpoint failed with, if any. Closing a DB created with NewDB only stops its sweeper
+func (db *DB) Close() error {
+	db.closeOnce.Do(func() {
+		close(db.closing)
+	})
+	db.background.Wait()
+
+	if db.wal == nil {
+		return nil
+	}
+
+	if err := db.wal.close(); err != nil {
+		return err
+	}
+	return db.checkpointErr
+}
+
+// segmentExt is the extension of log segment files. Segments are numbered in the order they are created, zero padded
+// so they sort in order
+const segmentExt = ".wal"
+
+func segmentName(seq uint64) string {
+	return fmt.Sprintf("%020d%s", seq, segmentExt)
+}
+
+// segmentSeq returns the number of the segment called name
+func segmentSeq(name string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+}
+
+// recordHeaderSize is the size of the header before every record in the log: the payload's length and its IEEE
+// crc32, both uint32s
+const recordHeaderSize = 8
+
+// wal is the write-ahead log of a DB opened with Open
+type wal struct {
+	mu  sync.Mutex
+	dir string
+	f   *os.File
+	// seq is the number of the segment being appended to
+	seq uint64
+	// size is the length of the segment being appended to, up to the end of its last complete record
+	size int64
+	// last is the latest commit timestamp appended to the log
+	last uint64
+	// full is signalled when the segment being appended to grows past fullSize, if set
+	full     chan struct{}
+	fullSize int64
+	// err is set once an append fails. The log may no longer hold exactly the records that were applied, so every
+	// later append fails as well
+	err error
+}
+
+// append writes payload, the record for commit ts, to the log and syncs it to disk
+func (w *wal) append(ts uint64, payload []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	rec := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(rec[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(payload))
+	copy(rec[recordHeaderSize:], payload)
+
+	if _, err := w.f.Write(rec); err != nil {
+		return w.fail(err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return w.fail(err)
+	}
+
+	w.size += int64(len(rec))
+	if ts > w.last {
+		w.last = ts
+	}
+
+	if w.fullSize > 0 && w.size >= w.fullSize {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// rotate starts appending to a new segment. It returns the number of the new segment, and the latest commit timestamp
+// appended to the segments before it
+func (w *wal) rotate() (uint64, uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return 0, 0, w.err
+	}
+
+	f, err := os.OpenFile(filepath.Join(w.dir, segmentName(w.seq+1)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := syncDir(w.dir); err != nil {
+		f.Close()
+		return 0, 0, err
+	}
+
+	// every record was synced as it was appended, so there is nothing left to flush
+	w.f.Close()
+	w.f = f
+	w.seq++
+	w.size = 0
+
+	return w.seq, w.last, nil
+}
+
+// fail stops the log taking any more records after err. w.mu must be held
+func (w *wal) fail(err error) error {
+	// a partly written record would only be cut off by the next recovery anyway, but dropping it now saves recovery
+	// the trouble
+	w.f.Truncate(w.size)
+	w.err = fmt.Errorf("write-ahead log failed: %w", err)
+
+	return w.err
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err == ErrClosed {
+		return nil
+	}
+	w.err = ErrClosed
+
+	return w.f.Close()
+}
+
+// segments returns the names of the log segments in dir, oldest first
+func segments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), segmentExt) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// recover loads the latest checkpoint in dir, replays the log segments after it and opens the last segment for
+// appending, creating it if there are none
+func (db *DB) recover(dir string) (*wal, error) {
+	// checkpoints still being written when the process stopped
+	tmps, err := filepath.Glob(filepath.Join(dir, "checkpoint-*.tmp"))
+	if err != nil {
+		return nil, err
+	}
+	for _, tmp := range tmps {
+		os.Remove(tmp)
+	}
+
+	ckpt, err := db.loadCheckpoint(dir, math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int64
+	for i, name := range names {
+		last := i == len(names)-1
+		if size, err = db.replaySegment(filepath.Join(dir, name), last, ckpt); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range db.tables {
+		t.collect(atomic.LoadUint64(&db.clock))
+	}
+	db.sweepIfExpiring()
+
+	seq := uint64(1)
+	if len(names) > 0 {
+		if seq, err = segmentSeq(names[len(names)-1]); err != nil {
+			return nil, fmt.Errorf("%w: bad segment name %q", ErrBadLog, names[len(names)-1])
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(seq)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syncDir(dir); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &wal{dir: dir, f: f, seq: seq, size: size, last: db.issued, full: make(chan struct{}, 1)}, nil
+}
+
+// replaySegment replays every record in the segment at path written after checkpoint ckpt, returning the length of
+// the segment up to the end of its last complete record. A torn record at the end of the last segment is cut off
+func (db *DB) replaySegment(path string, last bool, ckpt uint64) (int64, error) {
+	size, torn, err := scanSegment(path, last, func(rec *logRecord) error {
+		if rec.ts <= ckpt {
+			// already in the checkpoint
+			return nil
+		}
+		return db.replay(rec, ckpt > 0)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if torn {
+		if err := truncate(path, size); err != nil {
+			return 0, err
+		}
+	}
+
+	return size, nil
+}
+
+// scanSegment calls fn with every record in the segment at path, in the order they were logged. It returns the length
+// of the segment up to the end of its last complete record, and whether a torn or corrupt record came after it. A bad
+// record ends the last segment, and is an error anywhere else, since later segments were written after it
+func scanSegment(path string, last bool, fn func(rec *logRecord) error) (int64, bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false, err
+	}
+
+	off := 0
+	for off < len(b) {
+		payload, ok := readRecord(b[off:])
+		if !ok {
+			if !last {
+				return 0, false, fmt.Errorf("%w: bad record at offset %d of %s", ErrBadLog, off, filepath.Base(path))
+			}
+			return int64(off), true, nil
+		}
+
+		rec, err := decodeRecord(payload)
+		if err == nil {
+			err = fn(rec)
+		}
+		if err != nil {
+			return 0, false, fmt.Errorf("%w: record at offset %d of %s: %v", ErrBadLog, off, filepath.Base(path), err)
+		}
+
+		off += recordHeaderSize + len(payload)
+	}
+
+	return int64(off), false, nil
+}
+
+// readRecord returns the payload of the record at the start of b, or false if the record is incomplete or its
+// checksum doesn't match
+func readRecord(b []byte) ([]byte, bool) {
+	if len(b) < recordHeaderSize {
+		return nil, false
+	}
+
+	n := binary.BigEndian.Uint32(b[0:4])
+	if uint64(n) > uint64(len(b)-recordHeaderSize) {
+		return nil, false
+	}
+
+	payload := b[recordHeaderSize : recordHeaderSize+int(n)]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(b[4:8]) {
+		return nil, false
+	}
+
+	return payload, true
+}
+
+// truncate cuts the file at path to size and syncs it
+func truncate(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// syncDir syncs dir, so files created or renamed in it survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// recordKind is the kind of change a log record holds
+type recordKind uint8
+
+const (
+	recordCommit recordKind = iota + 1
+	recordCreateTable
+	recordDropTable
+	recordAddColumn
+	recordDropColumn
+	recordCreateIndex
+)
+
+// logRecord is one change in the log: a commit, or a schema change. Schema changes take a commit timestamp of their
+// own, so every record is stamped with the commit it was applied at
+type logRecord struct {
+	kind recordKind
+	ts   uint64
+	// at is when the record was logged
+	at time.Time
+	// writes holds a commit's writes to each table by name, with nil versions for deleted rows
+	writes map[string]map[rowID]*version
+	// table is the table a schema change applies to
+	table string
+	// def is the definition of a created table
+	def Table
+	// column is the column added or dropped
+	column string
+	// index is the index created
+	index Index
+}
+
+// logCommit logs the writes in views, if the DB has a log. The writes must have been resolved
+func (db *DB) logCommit(ts uint64, names []string, views map[string]*view) error {
+	if db.wal == nil {
+		return nil
+	}
+
+	rec := &logRecord{kind: recordCommit, ts: ts, at: db.now(), writes: make(map[string]map[rowID]*version, len(names))}
+	for _, name := range names {
+		rec.writes[name] = views[name].writes
+	}
+
+	return db.wal.append(ts, rec.encode())
+}
+
+// changeSchema makes a schema change by calling apply. If the DB has a log, the change is logged first and given
+// the next commit timestamp, which is only published once the change is applied, so checkpoints taken at the
+// timestamp include it
+func (db *DB) changeSchema(rec *logRecord, apply func()) error {
+	if db.wal == nil {
+		apply()
+		return nil
+	}
+
+	rec.ts = db.issue()
+	rec.at = db.now()
+	defer db.publish(rec.ts)
+
+	if err := db.wal.append(rec.ts, rec.encode()); err != nil {
+		return err
+	}
+
+	apply()
+	return nil
+}
+
+func (r *logRecord) encode() []byte {
+	var buf bytes.Buffer
+	e := &encoder{w: &buf}
+
+	e.uint8(uint8(r.kind))
+	e.uint64(r.ts)
+	e.time(r.at)
+
+	switch r.kind {
+	case recordCommit:
+		names := make([]string, 0, len(r.writes))
+		for name := range r.writes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		e.uint32(uint32(len(names)))
+		for _, name := range names {
+			writes := r.writes[name]
+			e.string(name)
+			e.uint32(uint32(len(writes)))
+			for _, rid := range sortedRowIDs(writes) {
+				ver := writes[rid]
+				e.uint64(uint64(rid))
+				e.bool(ver == nil)
+				if ver != nil {
+					e.bytes(ver.data)
+					e.vals(ver.vals)
+					e.time(ver.expires)
+				}
+			}
+		}
+	case recordCreateTable:
+		e.table(r.def)
+		e.options(r.def)
+	case recordDropTable:
+		e.string(r.table)
+	case recordAddColumn, recordDropColumn:
+		e.string(r.table)
+		e.string(r.column)
+	case recordCreateIndex:
+		e.string(r.table)
+		e.string(r.index.Column)
+		e.bool(r.index.Ordered)
+		e.bool(r.index.Unique)
+	}
+
+	return buf.Bytes()
+}
+
+func decodeRecord(b []byte) (*logRecord, error) {
+	d := &decoder{b: b}
+	r := &logRecord{kind: recordKind(d.uint8()), ts: d.uint64(), at: d.time()}
+
+	switch r.kind {
+	case recordCommit:
+		n := d.uint32()
+		r.writes = make(map[string]map[rowID]*version)
+		for i := uint32(0); i < n && d.err == nil; i++ {
+			name := d.string()
+			writes := make(map[rowID]*version)
+			rows := d.uint32()
+			for j := uint32(0); j < rows && d.err == nil; j++ {
+				rid := rowID(d.uint64())
+				if deleted := d.bool(); deleted {
+					writes[rid] = nil
+					continue
+				}
+				writes[rid] = &version{data: d.bytes(), vals: d.vals(), expires: d.time()}
+			}
+			r.writes[name] = writes
+		}
+	case recordCreateTable:
+		r.def = d.table()
+		// the log always holds every option
+		d.options(&r.def, snapshotVersion)
+	case recordDropTable:
+		r.table = d.string()
+	case recordAddColumn, recordDropColumn:
+		r.table = d.string()
+		r.column = d.string()
+	case recordCreateIndex:
+		r.table = d.string()
+		r.index.Column = d.string()
+		r.index.Ordered = d.bool()
+		r.index.Unique = d.bool()
+	default:
+		return nil, fmt.Errorf("unknown record kind %d", r.kind)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.b) > 0 {
+		return nil, fmt.Errorf("%d bytes of trailing data", len(d.b))
+	}
+
+	return r, nil
+}
+
+// replay applies a logged change to the DB. It is only used while recovering, before the DB is shared.
+//
+// A checkpoint includes every change up to its timestamp, but may also include schema changes logged after it, since
+// those are applied before their timestamps are published. Replaying the log after a checkpoint in order still ends
+// with the right schema, as long as changes that are already in place, or that apply to tables the checkpoint has
+// already seen dropped, are skipped; overlap allows for that
+func (db *DB) replay(r *logRecord, overlap bool) error {
+	// commits on different tables can be logged out of timestamp order, so the clock is the latest seen
+	if r.ts > db.issued {
+		db.issued = r.ts
+		atomic.StoreUint64(&db.clock, r.ts)
+	}
+
+	var t *table
+	if r.kind != recordCommit && r.kind != recordCreateTable {
+		if t = db.tables[r.table]; t == nil {
+			if overlap {
+				return nil
+			}
+			return &Error{Err: ErrTableNotFound, Table: r.table}
+		}
+	}
+
+	switch r.kind {
+	case recordCommit:
+		for name, writes := range r.writes {
+			t := db.tables[name]
+			if t == nil {
+				if overlap {
+					continue
+				}
+				return &Error{Err: ErrTableNotFound, Table: name}
+			}
+
+			for _, rid := range sortedRowIDs(writes) {
+				ver := writes[rid]
+				if ver != nil {
+					// columns a commit created on the fly aren't logged on their own
+					for c := range ver.vals {
+						t.addColumns([]string{string(c)})
+					}
+				}
+				t.install(rid, ver, r.ts)
+
+				if rid >= t.nextID {
+					t.nextID = rid + 1
+				}
+			}
+		}
+	case recordCreateTable:
+		if _, found := db.tables[r.def.Name]; found {
+			if overlap {
+				return nil
+			}
+			return &Error{Err: ErrTableExists, Table: r.def.Name}
+		}
+		if db.strict {
+			r.def.Strict = true
+		}
+		if err := checkEviction(r.def); err != nil {
+			return err
+		}
+		db.tables[r.def.Name] = newTable(r.def)
+	case recordDropTable:
+		db.dropTable(t)
+	case recordAddColumn:
+		t.addColumns([]string{r.column})
+	case recordDropColumn:
+		t.dropColumn(colName(r.column))
+	case recordCreateIndex:
+		t.createIndex(r.index)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package inmem_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+var walTables = []inmem.Table{
+	{Name: "imports", Columns: []string{"csid"}, Unique: []string{"id"}},
+	{Name: "profiles", PrimaryKey: "id"},
+}
+
+func TestOpen(t *testing.T) {
+
+	testCases := []struct {
+		name string
+		// write runs against the DB before it is closed and opened again
+		write func(db *inmem.DB) error
+		// damage changes the log once the DB is closed
+		damage  func(t *testing.T, log string)
+		read    func(r reader) ([][]byte, error)
+		want    [][]byte
+		wantErr error
+	}{
+		{
+			name: "should restore inserts, updates and deletes",
+			write: func(db *inmem.DB) error {
+				ctx := context.Background()
+				for _, err := range []error{
+					db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")),
+					db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, []byte("import2")),
+					db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import3", "cs2"}, []byte("import3")),
+					db.Delete(ctx, "imports", "id", "import2"),
+					db.UpdateRow(ctx, "imports", "id", "import3", []string{"csid"}, []string{"cs1"}, []byte("import3-moved")),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1"), []byte("import3-moved")},
+		},
+		{
+			name: "should restore empty and nil data as they were written",
+			write: func(db *inmem.DB) error {
+				ctx := context.Background()
+				if err := db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte{}); err != nil {
+					return err
+				}
+				return db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, nil)
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{{}, nil},
+		},
+		{
+			name: "should restore transactions across tables",
+			write: func(db *inmem.DB) error {
+				tx, err := db.Begin(context.Background())
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+
+				if err := tx.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")); err != nil {
+					return err
+				}
+				if err := tx.Upsert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1")); err != nil {
+					return err
+				}
+				return tx.Commit()
+			},
+			read: func(r reader) ([][]byte, error) {
+				data, err := r.GetByKey(context.Background(), "profiles", "user1")
+				return [][]byte{data}, err
+			},
+			want: [][]byte{[]byte("profile1")},
+		},
+		{
+			name: "should not restore rolled back transactions",
+			write: func(db *inmem.DB) error {
+				tx, err := db.Begin(context.Background())
+				if err != nil {
+					return err
+				}
+
+				if err := tx.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")); err != nil {
+					return err
+				}
+				return tx.Rollback()
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{},
+		},
+		{
+			name: "should restore schema changes",
+			write: func(db *inmem.DB) error {
+				ctx := context.Background()
+				for _, err := range []error{
+					db.CreateTable(ctx, inmem.Table{Name: "files", Columns: []string{"csid"}}),
+					db.Insert(ctx, "files", []string{"csid", "name"}, []string{"cs1", "b/file1"}, []byte("file1")),
+					db.CreateIndex(ctx, "files", inmem.Index{Column: "name", Ordered: true}),
+					db.DropTable(ctx, "profiles"),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			read: func(r reader) ([][]byte, error) {
+				return r.Query(context.Background(), "files", inmem.Prefix("name", "b/"))
+			},
+			want: [][]byte{[]byte("file1")},
+		},
+		{
+			name: "should cut off a torn record at the end of the log",
+			write: func(db *inmem.DB) error {
+				if err := db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")); err != nil {
+					return err
+				}
+				return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, []byte("import2"))
+			},
+			damage: func(t *testing.T, log string) {
+				info, err := os.Stat(log)
+				if assert.Nil(t, err) {
+					assert.Nil(t, os.Truncate(log, info.Size()-3))
+				}
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1")},
+		},
+		{
+			name: "should cut off a corrupted record at the end of the log",
+			write: func(db *inmem.DB) error {
+				if err := db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")); err != nil {
+					return err
+				}
+				return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, []byte("import2"))
+			},
+			damage: func(t *testing.T, log string) {
+				b, err := os.ReadFile(log)
+				if assert.Nil(t, err) {
+					b[len(b)-2] ^= 1
+					assert.Nil(t, os.WriteFile(log, b, 0o644))
+				}
+			},
+			read: getRows("imports", "csid", "cs1"),
+			want: [][]byte{[]byte("import1")},
+		},
+		{
+			name: "should fail writes once closed",
+			write: func(db *inmem.DB) error {
+				if err := db.Close(); err != nil {
+					return err
+				}
+				return db.Insert(context.Background(), "imports", []string{"id"}, []string{"import1"}, []byte("import1"))
+			},
+			wantErr: inmem.ErrClosed,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			dir := t.TempDir()
+			db, err := inmem.Open(dir, walTables)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			err = tc.write(db)
+			if tc.wantErr != nil {
+				assert.True(t, errors.Is(err, tc.wantErr), "got %v", err)
+				return
+			}
+			if !assert.Nil(t, err) || !assert.Nil(t, db.Close()) {
+				return
+			}
+
+			if tc.damage != nil {
+				logs, _ := filepath.Glob(filepath.Join(dir, "*.wal"))
+				if !assert.Len(t, logs, 1) {
+					return
+				}
+				tc.damage(t, logs[0])
+			}
+
+			db, err = inmem.Open(dir, walTables)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer db.Close()
+
+			got, err := tc.read(db)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+
+			// the log takes new writes after recovery, and they survive another restart
+			if !assert.Nil(t, db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import9", "cs9"}, []byte("import9"))) {
+				return
+			}
+			assert.Nil(t, db.Close())
+
+			db, err = inmem.Open(dir, walTables)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer db.Close()
+
+			got, err = tc.read(db)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+
+			got, err = db.Get(context.Background(), "imports", "csid", "cs9")
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{[]byte("import9")}, got)
+		})
+	}
+}
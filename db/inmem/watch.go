@@ -0,0 +1,279 @@
+package inmem
+
+import (
+	"context"
+	"sync"
+)
+
+// Op is the kind of write a Change records
+type Op int
+
+// Ops a Change can record
+const (
+	OpInsert Op = iota + 1
+	OpUpdate
+	OpDelete
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpInsert:
+		return "insert"
+	case OpUpdate:
+		return "update"
+	case OpDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Change is one row written by a commit, as sent to watchers
+type Change struct {
+	Op    Op
+	Table string
+	// TS is the timestamp of the commit that made the change, as returned by LastCommit
+	TS uint64
+	// Cols holds the row's indexed values by column: as written for inserts and updates, and as they were before
+	// for deletes
+	Cols map[string]string
+	// Before is the row's data before the change, nil for inserts. After is its data after, nil for deletes
+	Before []byte
+	After  []byte
+	// Missed is the number of changes dropped just before this one because the watcher fell behind. It is only ever
+	// set for watchers made with WithWatchDrop
+	Missed int
+}
+
+// defaultWatchBuffer is how many changes a watcher's channel holds unless WithWatchBuffer says otherwise
+const defaultWatchBuffer = 64
+
+// WatchOption configures a watcher when it is created with Watch
+type WatchOption func(*watcher)
+
+// WithWatchBuffer sets how many changes the watcher's channel holds before the watcher counts as behind
+func WithWatchBuffer(n int) WatchOption {
+	return func(w *watcher) {
+		w.buffer = n
+	}
+}
+
+// WithWatchDrop makes commits drop changes for the watcher while it is behind, rather than wait for it. The next
+// change it does receive counts how many were dropped in Change.Missed
+func WithWatchDrop() WatchOption {
+	return func(w *watcher) {
+		w.drop = true
+	}
+}
+
+// watcher is one caller of Watch
+type watcher struct {
+	ctx    context.Context
+	filter Predicate
+	buffer int
+	drop   bool
+
+	// mu guards sending on ch against closing it
+	mu     sync.Mutex
+	ch     chan Change
+	closed bool
+	// missed counts the changes dropped since the last one sent
+	missed int
+}
+
+// Watch returns a channel receiving every change committed to table from now on that matches filter, until ctx is
+// done, when the channel is closed. A nil filter matches every change; updates match if the row matches either
+// before or after. Changes are sent in commit order for each table, including rows deleted by eviction, but not rows
+// removed by expiry
+//
+// By default a commit waits for every watcher of the tables it wrote to take its changes, so a watcher that falls
+// behind holds up writes to those tables. Changes are sent once the tables are unlocked, so the watcher can still read
+// them while it is behind, but it must not write to them itself. WithWatchDrop drops changes for the watcher instead
+func (db *DB) Watch(ctx context.Context, table string, filter Predicate, opts ...WatchOption) (<-chan Change, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if filter == nil {
+		filter = And()
+	}
+	w := &watcher{ctx: ctx, filter: filter, buffer: defaultWatchBuffer}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.ch = make(chan Change, w.buffer)
+
+	// the table is read locked so the watcher starts between two commits
+	t := db.lookup(table)
+	if t == nil {
+		return nil, &Error{Err: ErrTableNotFound, Table: table}
+	}
+	if err := t.mu.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer t.mu.runlock()
+	if t.dropped {
+		return nil, &Error{Err: ErrTableNotFound, Table: table}
+	}
+
+	db.watchMu.Lock()
+	if db.watchers == nil {
+		db.watchers = make(map[string]map[*watcher]bool)
+	}
+	if db.watchers[table] == nil {
+		db.watchers[table] = make(map[*watcher]bool)
+	}
+	db.watchers[table][w] = true
+	db.watchMu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-db.closing:
+		}
+
+		db.watchMu.Lock()
+		delete(db.watchers[table], w)
+		if len(db.watchers[table]) == 0 {
+			delete(db.watchers, table)
+		}
+		db.watchMu.Unlock()
+
+		w.mu.Lock()
+		w.closed = true
+		close(w.ch)
+		w.mu.Unlock()
+	}()
+
+	return w.ch, nil
+}
+
+// watching returns the watchers of table
+func (db *DB) watching(table string) []*watcher {
+	db.watchMu.RLock()
+	defer db.watchMu.RUnlock()
+
+	watchers := make([]*watcher, 0, len(db.watchers[table]))
+	for w := range db.watchers[table] {
+		watchers = append(watchers, w)
+	}
+	return watchers
+}
+
+// change is a Change along with the row's indexed values before and after it, for matching against filters. Either
+// is nil if the row didn't exist
+type change struct {
+	Change
+	before, after map[colName]val
+}
+
+// changes returns the changes the transaction's writes make to the table, if anyone is watching it. The writes must
+// have been resolved and not yet applied, with the table locked
+func (v *view) changes(watchers []*watcher) []change {
+	if len(watchers) == 0 {
+		return nil
+	}
+
+	changes := make([]change, 0, len(v.writes))
+	for _, rid := range sortedRowIDs(v.writes) {
+		ver, old := v.writes[rid], v.t.latest(rid)
+
+		c := change{Change: Change{Table: v.t.name}}
+		switch {
+		case ver == nil && old == nil:
+			continue
+		case ver == nil:
+			c.Op, c.Before, c.Cols = OpDelete, old.data, cols(old.vals)
+			c.before = old.vals
+		case old == nil:
+			c.Op, c.After, c.Cols = OpInsert, ver.data, cols(ver.vals)
+			c.after = ver.vals
+		default:
+			c.Op, c.Before, c.After, c.Cols = OpUpdate, old.data, ver.data, cols(ver.vals)
+			c.before, c.after = old.vals, ver.vals
+		}
+		changes = append(changes, c)
+	}
+
+	return changes
+}
+
+// cols returns vals keyed by plain strings
+func cols(vals map[colName]val) map[string]string {
+	m := make(map[string]string, len(vals))
+	for c, v := range vals {
+		m[string(c)] = string(v)
+	}
+	return m
+}
+
+// delivery is a commit's changes to one table, sent to the table's watchers once the commit has unlocked it
+type delivery struct {
+	watchers []*watcher
+	ts       uint64
+	changes  []change
+	// prev is closed once the commit to the table before this one has sent its changes, done once this one has
+	prev, done chan struct{}
+}
+
+// delivery returns the changes committed at ts for the table's watchers, queued behind those of earlier commits. The
+// table must be write locked
+func (v *view) delivery(watchers []*watcher, ts uint64, changes []change) *delivery {
+	d := &delivery{watchers: watchers, ts: ts, changes: changes, prev: v.t.sent, done: make(chan struct{})}
+	v.t.sent = d.done
+	return d
+}
+
+// send waits for the commit before to send its changes, then sends d's
+func (d *delivery) send(closing <-chan struct{}) {
+	if d.prev != nil {
+		<-d.prev
+	}
+	notify(d.watchers, d.ts, d.changes, closing)
+	close(d.done)
+}
+
+// notify sends the changes committed at ts to every watcher they match
+func notify(watchers []*watcher, ts uint64, changes []change, closing <-chan struct{}) {
+	for _, w := range watchers {
+		for _, c := range changes {
+			if !w.matches(c) {
+				continue
+			}
+			c.TS = ts
+			w.send(c.Change, closing)
+		}
+	}
+}
+
+// matches reports whether c matches the watcher's filter, before or after
+func (w *watcher) matches(c change) bool {
+	return c.before != nil && w.filter.match(c.before) || c.after != nil && w.filter.match(c.after)
+}
+
+// send sends c to the watcher, waiting for room unless the watcher drops changes. It gives up once the watcher or
+// the DB is closed
+func (w *watcher) send(c Change, closing <-chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	c.Missed = w.missed
+	if w.drop {
+		select {
+		case w.ch <- c:
+			w.missed = 0
+		default:
+			w.missed++
+		}
+		return
+	}
+
+	select {
+	case w.ch <- c:
+	case <-w.ctx.Done():
+	case <-closing:
+	}
+}
@@ -0,0 +1,267 @@
+package inmem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jjg-akers/inmem-db/db/inmem"
+	"github.com/stretchr/testify/assert"
+)
+
+// receive takes n changes from ch, failing if they don't arrive
+func receive(t *testing.T, ch <-chan inmem.Change, n int) []inmem.Change {
+	var got []inmem.Change
+	var last uint64
+	for len(got) < n {
+		select {
+		case c, ok := <-ch:
+			if !assert.True(t, ok, "channel closed") {
+				return got
+			}
+			// timestamps never go backwards, but are otherwise left out of comparisons
+			assert.GreaterOrEqual(t, c.TS, last)
+			last, c.TS = c.TS, 0
+			got = append(got, c)
+		case <-time.After(time.Second):
+			t.Errorf("got %d changes, want %d", len(got), n)
+			return got
+		}
+	}
+	return got
+}
+
+func TestDB_Watch(t *testing.T) {
+
+	testCases := []struct {
+		name   string
+		filter inmem.Predicate
+		write  func(db *inmem.DB) error
+		want   []inmem.Change
+	}{
+		{
+			name: "should send inserts, updates and deletes in order",
+			write: func(db *inmem.DB) error {
+				ctx := context.Background()
+				for _, err := range []error{
+					db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")),
+					db.UpdateRow(ctx, "imports", "id", "import1", []string{"csid"}, []string{"cs2"}, []byte("import1-moved")),
+					db.Delete(ctx, "imports", "id", "import1"),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: []inmem.Change{
+				{Op: inmem.OpInsert, Table: "imports", Cols: map[string]string{"id": "import1", "csid": "cs1"}, After: []byte("import1")},
+				{Op: inmem.OpUpdate, Table: "imports", Cols: map[string]string{"id": "import1", "csid": "cs2"}, Before: []byte("import1"), After: []byte("import1-moved")},
+				{Op: inmem.OpDelete, Table: "imports", Cols: map[string]string{"id": "import1", "csid": "cs2"}, Before: []byte("import1-moved")},
+			},
+		},
+		{
+			name:   "should only send changes matching the filter, before or after",
+			filter: inmem.Eq("csid", "cs1"),
+			write: func(db *inmem.DB) error {
+				ctx := context.Background()
+				for _, err := range []error{
+					db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")),
+					db.Insert(ctx, "imports", []string{"id", "csid"}, []string{"import2", "cs2"}, []byte("import2")),
+					db.UpdateRow(ctx, "imports", "id", "import1", []string{"csid"}, []string{"cs3"}, []byte("import1-moved")),
+					db.Delete(ctx, "imports", "id", "import1"),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: []inmem.Change{
+				{Op: inmem.OpInsert, Table: "imports", Cols: map[string]string{"id": "import1", "csid": "cs1"}, After: []byte("import1")},
+				{Op: inmem.OpUpdate, Table: "imports", Cols: map[string]string{"id": "import1", "csid": "cs3"}, Before: []byte("import1"), After: []byte("import1-moved")},
+			},
+		},
+		{
+			name: "should send every row a transaction writes to the table",
+			write: func(db *inmem.DB) error {
+				tx, err := db.Begin(context.Background())
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+
+				for _, err := range []error{
+					tx.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import1", "cs1"}, []byte("import1")),
+					tx.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{"import2", "cs1"}, []byte("import2")),
+					tx.Insert(context.Background(), "profiles", []string{"id"}, []string{"user1"}, []byte("profile1")),
+				} {
+					if err != nil {
+						return err
+					}
+				}
+				return tx.Commit()
+			},
+			want: []inmem.Change{
+				{Op: inmem.OpInsert, Table: "imports", Cols: map[string]string{"id": "import1", "csid": "cs1"}, After: []byte("import1")},
+				{Op: inmem.OpInsert, Table: "imports", Cols: map[string]string{"id": "import2", "csid": "cs1"}, After: []byte("import2")},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := inmem.NewDB(walTables)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ch, err := db.Watch(ctx, "imports", tc.filter)
+			if !assert.Nil(t, err) || !assert.Nil(t, tc.write(db)) {
+				return
+			}
+
+			assert.Equal(t, tc.want, receive(t, ch, len(tc.want)))
+
+			// nothing else arrives, and the channel closes with the context
+			cancel()
+			_, ok := <-ch
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestDB_WatchSlow(t *testing.T) {
+
+	insert := func(db *inmem.DB, id string) error {
+		return db.Insert(context.Background(), "imports", []string{"id", "csid"}, []string{id, "cs1"}, []byte(id))
+	}
+
+	t.Run("should drop changes and report how many were missed", func(t *testing.T) {
+		db := inmem.NewDB(walTables)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch, err := db.Watch(ctx, "imports", nil, inmem.WithWatchBuffer(1), inmem.WithWatchDrop())
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		for _, id := range []string{"import1", "import2", "import3"} {
+			if !assert.Nil(t, insert(db, id)) {
+				return
+			}
+		}
+		got := receive(t, ch, 1)
+		if !assert.Nil(t, insert(db, "import4")) {
+			return
+		}
+		got = append(got, receive(t, ch, 1)...)
+
+		if assert.Len(t, got, 2) {
+			assert.Equal(t, []byte("import1"), got[0].After)
+			assert.Equal(t, 0, got[0].Missed)
+			assert.Equal(t, []byte("import4"), got[1].After)
+			assert.Equal(t, 2, got[1].Missed)
+		}
+	})
+
+	t.Run("should hold up writes until a blocking watcher catches up", func(t *testing.T) {
+		db := inmem.NewDB(walTables)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch, err := db.Watch(ctx, "imports", nil, inmem.WithWatchBuffer(1))
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		done := make(chan error)
+		go func() {
+			for _, id := range []string{"import1", "import2", "import3"} {
+				if err := insert(db, id); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("writes finished without the watcher taking their changes")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		got := receive(t, ch, 3)
+		assert.Nil(t, <-done)
+		if assert.Len(t, got, 3) {
+			for i, id := range []string{"import1", "import2", "import3"} {
+				assert.Equal(t, []byte(id), got[i].After)
+			}
+		}
+	})
+
+	t.Run("should let a blocking watcher read the table while it is behind", func(t *testing.T) {
+		db := inmem.NewDB(walTables)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch, err := db.Watch(ctx, "imports", nil, inmem.WithWatchBuffer(1))
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		done := make(chan error)
+		go func() {
+			for _, id := range []string{"import1", "import2"} {
+				if err := insert(db, id); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("writes finished without the watcher taking their changes")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// the second insert is waiting on the watcher, but has already been applied
+		readCtx, readCancel := context.WithTimeout(context.Background(), time.Second)
+		defer readCancel()
+		rows, err := db.Get(readCtx, "imports", "csid", "cs1")
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("import1"), []byte("import2")}, rows)
+
+		got := receive(t, ch, 2)
+		assert.Nil(t, <-done)
+		assert.Len(t, got, 2)
+	})
+
+	t.Run("should stop waiting once the watcher is cancelled", func(t *testing.T) {
+		db := inmem.NewDB(walTables)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, err := db.Watch(ctx, "imports", nil, inmem.WithWatchBuffer(1))
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		assert.Nil(t, insert(db, "import1"))
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+		assert.Nil(t, insert(db, "import2"))
+	})
+}
+
+func TestDB_WatchErrors(t *testing.T) {
+
+	db := inmem.NewDB(walTables)
+	_, err := db.Watch(context.Background(), "files", nil)
+	assert.Equal(t, &inmem.Error{Err: inmem.ErrTableNotFound, Table: "files"}, err)
+}
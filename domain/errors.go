@@ -6,6 +6,6 @@ import "errors"
 var (
 	ErrValidation          = errors.New("invalid import status")
 	ErrImportAlreadyExists = errors.New("import ID already exists")
-	ErrUserAlreadyExists   = errors.New("import ID already exists")
+	ErrUserAlreadyExists   = errors.New("user ID already exists")
 	ErrInvalidInput        = errors.New("invalid input")
 )
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
 
+	"github.com/jjg-akers/inmem-db/db/inmem"
 	"github.com/jjg-akers/inmem-db/domain"
 )
 
@@ -47,7 +49,12 @@ func (u *Service) StoreNewProfile(ctx context.Context, domainProfile domain.Prof
 		return err
 	}
 
-	return u.db.Insert(ctx, "profiles", []string{"id"}, []string{p.ProfileID}, b)
+	err = u.db.Insert(ctx, "profiles", []string{"id"}, []string{p.ProfileID}, b)
+	if errors.Is(err, inmem.ErrUniqueViolation) {
+		return fmt.Errorf("%w: %s", domain.ErrUserAlreadyExists, p.ProfileID)
+	}
+
+	return err
 }
 
 // UpdateProfile updates profile's first and last names
@@ -75,7 +82,13 @@ func (u *Service) UpdateProfile(ctx context.Context, domainProfile domain.Profil
 		return fmt.Errorf("%v", err)
 	}
 
-	return u.db.Update(ctx, "profiles", "id", domainProfile.ProfileID, ub)
+	err = u.db.Update(ctx, "profiles", "id", domainProfile.ProfileID, ub)
+	if errors.Is(err, inmem.ErrValueNotFound) {
+		// the profile was deleted after it was read
+		return fmt.Errorf("%w: profile not found", domain.ErrInvalidInput)
+	}
+
+	return err
 }
 
 // GetProfile ... retrieves a profile from the db. This satisfies the importstatus.UserService interface
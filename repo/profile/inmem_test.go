@@ -43,6 +43,7 @@ func TestProfileService_StoreNewUser(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
+		setup   func(s *ps.Service) error
 		wantErr error
 	}{
 		{
@@ -56,18 +57,44 @@ func TestProfileService_StoreNewUser(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "should fail due to profile already existing",
+			args: args{
+				u: domain.Profile{
+					ProfileID:   "00000000-0000-0000-0000-000000000001",
+					ProfileName: "username",
+				},
+			},
+			setup: func(s *ps.Service) error {
+				u := domain.Profile{
+					ProfileID:   "00000000-0000-0000-0000-000000000001",
+					ProfileName: "test-username",
+				}
+
+				return s.StoreNewProfile(context.Background(), u)
+			},
+			wantErr: fmt.Errorf("%w: %s", domain.ErrUserAlreadyExists, "00000000-0000-0000-0000-000000000001"),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s, err := ps.NewService(inmem.NewDB([]inmem.Table{
 				{
-					Name: "profiles",
+					Name:   "profiles",
+					Unique: []string{"id"},
 				},
 			}))
 
 			if err != nil {
 				t.Fatal(err)
 			}
+
+			if tt.setup != nil {
+				if err := tt.setup(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+
 			assert.Equal(t, tt.wantErr, s.StoreNewProfile(context.Background(), tt.args.u))
 		})
 	}